@@ -5,100 +5,327 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 var CASBAN_API = "https://api.cas.chat/check?user_id="
 var LOLSBOT_API = "https://api.lols.bot/account?id="
 
+const DEFAULT_PROVIDER_TIMEOUT = 10 * time.Second
+const DEFAULT_POSITIVE_TTL = 24 * time.Hour
+const DEFAULT_NEGATIVE_TTL = time.Hour
+
+// BanProvider is an external ban list.
+type BanProvider interface {
+	Name() string
+	Weight() float64
+	// TTL of cached verdict
+	TTL(banned bool) time.Duration
+	Check(userid int64) (BanResult, error)
+}
+
+type BanResult struct {
+	Provider string
+	Weight   float64
+	Banned   bool
+	Offenses int
+	Score    float32
+}
+
+// BanVerdict is a cached BanResult
+type BanVerdict struct {
+	Provider string    `json:"provider"`
+	UserID   int64     `json:"user_id"`
+	Banned   bool      `json:"banned"`
+	Offenses int       `json:"offenses,omitempty"`
+	Score    float32   `json:"score,omitempty"`
+	Expires  time.Time `json:"expires"`
+}
+
+type BanProviderConfig struct {
+	Type        string         `yaml:"type"` //cas, lols or local, provider name by default
+	URL         string         `yaml:"url"`  //User ID is appended to the url
+	Timeout     time.Duration  `yaml:"timeout"`
+	Weight      float64        `yaml:"weight"`
+	Enabled     *bool          `yaml:"enabled"`
+	PositiveTTL *time.Duration `yaml:"positive_ttl"` //How long to remember banned users, 0 is not cached
+	NegativeTTL *time.Duration `yaml:"negative_ttl"` //How long to remember clean users, 0 is not cached
+}
+
 type casban_response struct {
 	Status      bool   `json:"ok"`
 	Description string `json:"description"`
 }
 
-var casban casban_response
-
 type lolsbot_response struct {
 	Status   bool    `json:"banned"`
 	Offenses int     `json:"offenses"`
 	Score    float32 `json:"spam_factor"`
 }
 
-var lolsbot lolsbot_response
+var banProviders []BanProvider
+var banProvidersMutex sync.RWMutex
 
-func isUserApiBanned(userid int) bool {
-	casbanned := isUserCasBanned(userid)
-	lolsbanned := isUserLolsBanned(userid)
-	slog.Info(fmt.Sprintf("User %d ban status: CAS:%t LOLS:%t", userid, casbanned, lolsbanned))
-	return casbanned || lolsbanned
+func defaultBanProviders() map[string]BanProviderConfig {
+	return map[string]BanProviderConfig{
+		"cas":  {URL: CASBAN_API},
+		"lols": {URL: LOLSBOT_API},
+	}
 }
 
-func isUserCasBanned(userid int) bool {
-	http.DefaultClient.Timeout = 10 * time.Second
-	// Send GET request
-	resp, err := http.Get(CASBAN_API + fmt.Sprint(userid))
-	if err != nil {
-		slog.Warn("Error sending request:", "error", err)
-		return false
+// readBanProviders builds providers from `ban_providers:` section.
+// Local ban list is always checked unless it's disabled explicitly.
+func readBanProviders() error {
+	configs := maps.Clone(MainConfig.BanProviders)
+	if len(configs) == 0 {
+		configs = defaultBanProviders()
+	}
+	if _, ok := configs["local"]; !ok {
+		configs["local"] = BanProviderConfig{}
 	}
 
-	defer resp.Body.Close()
-	// Check for successful response status code
-	if resp.StatusCode != http.StatusOK {
-		slog.Warn("Error status code:", "statusCode", resp.StatusCode)
-		return false
+	var providers []BanProvider
+	for name, config := range configs {
+		if config.Enabled != nil && !*config.Enabled {
+			slog.Info("Ban provider disabled: " + name)
+			continue
+		}
+		provider, err := newBanProvider(name, config)
+		if err != nil {
+			return err
+		}
+		providers = append(providers, provider)
 	}
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i].Name() < providers[j].Name()
+	})
 
-	// Read response body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		slog.Warn("Error reading response body:", "error", err)
-		return false
+	banProvidersMutex.Lock()
+	banProviders = providers
+	banProvidersMutex.Unlock()
+	slog.Info(fmt.Sprintf("Ban providers loaded: %d", len(providers)))
+	return nil
+}
+
+func newBanProvider(name string, config BanProviderConfig) (BanProvider, error) {
+	if config.Type == "" {
+		config.Type = name
+	}
+	if config.Timeout == 0 {
+		config.Timeout = DEFAULT_PROVIDER_TIMEOUT
+	}
+	if config.Weight == 0 {
+		config.Weight = 1
+	}
+	// Unset TTL is the default, explicit 0 turns the cache off
+	positiveTTL, negativeTTL := DEFAULT_POSITIVE_TTL, DEFAULT_NEGATIVE_TTL
+	if config.PositiveTTL != nil {
+		positiveTTL = *config.PositiveTTL
+	}
+	if config.NegativeTTL != nil {
+		negativeTTL = *config.NegativeTTL
+	}
+	base := apiProvider{
+		name:        name,
+		url:         config.URL,
+		weight:      config.Weight,
+		positiveTTL: positiveTTL,
+		negativeTTL: negativeTTL,
+		client:      &http.Client{Timeout: config.Timeout},
+	}
+
+	switch strings.ToLower(config.Type) {
+	case "cas":
+		if base.url == "" {
+			base.url = CASBAN_API
+		}
+		return &casProvider{base}, nil
+	case "lols":
+		if base.url == "" {
+			base.url = LOLSBOT_API
+		}
+		return &lolsProvider{base}, nil
+	case "local":
+		return &localProvider{name: name, weight: config.Weight}, nil
+	}
+	return nil, fmt.Errorf("ban provider %s: unknown type %q", name, config.Type)
+}
+
+func getBanProviders() []BanProvider {
+	banProvidersMutex.RLock()
+	defer banProvidersMutex.RUnlock()
+	return banProviders
+}
+
+// checkBanProviders queries all providers in parallel
+func checkBanProviders(userid int64) []BanResult {
+	providers := getBanProviders()
+	results := make([]BanResult, len(providers))
+
+	var wg sync.WaitGroup
+	for id, provider := range providers {
+		wg.Add(1)
+		go func(id int, provider BanProvider) {
+			defer wg.Done()
+			result := checkBanProvider(provider, userid)
+			result.Provider = provider.Name()
+			result.Weight = provider.Weight()
+			results[id] = result
+		}(id, provider)
+	}
+	wg.Wait()
+	return results
+}
+
+// checkBanProvider uses cached verdict if it's not expired yet.
+// Providers with zero TTL are not cached.
+func checkBanProvider(provider BanProvider, userid int64) BanResult {
+	if provider.TTL(true) == 0 && provider.TTL(false) == 0 {
+		result, err := provider.Check(userid)
+		if err != nil {
+			slog.Warn("Ban provider error:", "provider", provider.Name(), "error", err)
+		}
+		return result
 	}
 
-	err = json.Unmarshal(body, &casban)
+	now := time.Now().UTC()
+	if verdict := cache.GetVerdict(provider.Name(), userid); verdict != nil && verdict.Expires.After(now) {
+		apiCacheTotal.WithLabelValues(provider.Name(), "hit").Inc()
+		return BanResult{Banned: verdict.Banned, Offenses: verdict.Offenses, Score: verdict.Score}
+	}
+	apiCacheTotal.WithLabelValues(provider.Name(), "miss").Inc()
+
+	result, err := provider.Check(userid)
 	if err != nil {
-		slog.Warn("Error unmarshalling JSON:", "error", err)
-		return false
+		// Errors are not cached, ask again next time
+		slog.Warn("Ban provider error:", "provider", provider.Name(), "error", err)
+		return result
 	}
-	if casban.Status {
-		slog.Debug("User "+strconv.Itoa(userid)+" is CasBanned", "response", casban)
+	cache.SetVerdict(BanVerdict{
+		Provider: provider.Name(),
+		UserID:   userid,
+		Banned:   result.Banned,
+		Offenses: result.Offenses,
+		Score:    result.Score,
+		Expires:  now.Add(provider.TTL(result.Banned)),
+	})
+	return result
+}
+
+// banScore sums weights of providers which have the user banned
+func banScore(results []BanResult) float64 {
+	score := 0.0
+	for _, result := range results {
+		if result.Banned {
+			score += result.Weight
+		}
 	}
-	return casban.Status
+	return score
 }
 
-func isUserLolsBanned(userid int) bool {
-	http.DefaultClient.Timeout = 10 * time.Second
+func isUserApiBanned(userid int) bool {
+	results := checkBanProviders(int64(userid))
+	var status []string
+	for _, result := range results {
+		status = append(status, fmt.Sprintf("%s:%t", strings.ToUpper(result.Provider), result.Banned))
+	}
+	score := banScore(results)
+	slog.Info(fmt.Sprintf("User %d ban status: %s score:%.2f", userid, strings.Join(status, " "), score))
+	return score >= 1
+}
+
+// apiProvider is a common part of http json providers
+type apiProvider struct {
+	name        string
+	url         string
+	weight      float64
+	positiveTTL time.Duration
+	negativeTTL time.Duration
+	client      *http.Client
+}
+
+func (p *apiProvider) Name() string {
+	return p.name
+}
+
+func (p *apiProvider) Weight() float64 {
+	return p.weight
+}
+
+func (p *apiProvider) TTL(banned bool) time.Duration {
+	if banned {
+		return p.positiveTTL
+	}
+	return p.negativeTTL
+}
+
+func (p *apiProvider) get(userid int64, response any) error {
+	start := time.Now()
+	status := "error"
+	defer func() {
+		apiUsage.WithLabelValues(p.name).Inc()
+		apiRequestsTotal.WithLabelValues(p.name, status).Inc()
+		apiRequestDuration.WithLabelValues(p.name, status).Observe(time.Since(start).Seconds())
+	}()
+
 	// Send GET request
-	resp, err := http.Get(LOLSBOT_API + fmt.Sprint(userid))
+	resp, err := p.client.Get(p.url + strconv.FormatInt(userid, 10))
 	if err != nil {
-		slog.Warn("Error sending request:", "error", err)
-		return false
+		return fmt.Errorf("error sending request: %w", err)
 	}
-
 	defer resp.Body.Close()
+
+	status = strconv.Itoa(resp.StatusCode)
 	// Check for successful response status code
 	if resp.StatusCode != http.StatusOK {
-		slog.Warn("Error status code:", "statusCode", resp.StatusCode)
-		return false
+		return fmt.Errorf("error status code: %d", resp.StatusCode)
 	}
+
+	// Read response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		slog.Warn("Error reading response body:", "error", err)
-		return false
+		return fmt.Errorf("error reading response body: %w", err)
 	}
 
-	err = json.Unmarshal(body, &lolsbot)
+	err = json.Unmarshal(body, response)
 	if err != nil {
-		slog.Warn("Error unmarshalling JSON:", "error", err)
-		return false
+		return fmt.Errorf("error unmarshalling JSON: %w", err)
 	}
+	return nil
+}
 
-	if lolsbot.Status {
-		slog.Debug("User "+strconv.Itoa(userid)+" is CasBanned", "response", lolsbot)
+type casProvider struct {
+	apiProvider
+}
+
+func (p *casProvider) Check(userid int64) (BanResult, error) {
+	var casban casban_response
+	if err := p.get(userid, &casban); err != nil {
+		return BanResult{}, err
+	}
+	if casban.Status {
+		slog.Debug("User "+strconv.FormatInt(userid, 10)+" is CasBanned", "response", casban)
 	}
+	return BanResult{Banned: casban.Status}, nil
+}
 
-	return lolsbot.Status
+type lolsProvider struct {
+	apiProvider
+}
+
+func (p *lolsProvider) Check(userid int64) (BanResult, error) {
+	var lolsbot lolsbot_response
+	if err := p.get(userid, &lolsbot); err != nil {
+		return BanResult{}, err
+	}
+	if lolsbot.Status {
+		slog.Debug("User "+strconv.FormatInt(userid, 10)+" is LolsBanned", "response", lolsbot)
+	}
+	return BanResult{Banned: lolsbot.Status, Offenses: lolsbot.Offenses, Score: lolsbot.Score}, nil
 }
@@ -1,14 +1,62 @@
 package main
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 var CASBAN_BAD_ID = 5582880245
 var LOLSBOT_BAD_ID = 6656436060
 var GOOD_ID = 5485817729
 
+// banListServer answers like CAS or lols.bot, field is the json field with ban status
+func banListServer(t *testing.T, param string, field string, banned int) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userid, _ := strconv.Atoi(r.URL.Query().Get(param))
+		response := map[string]any{field: userid == banned}
+		if field == "banned" && userid == banned {
+			response["offenses"] = 3
+			response["spam_factor"] = 0.9
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func setupBanProviders(t *testing.T, configs map[string]BanProviderConfig) {
+	store, err := newJsonStore(filepath.Join(t.TempDir(), "cache.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache = store
+
+	MainConfig.BanProviders = configs
+	if err := readBanProviders(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testBanProviders(t *testing.T) map[string]BanProviderConfig {
+	cas := banListServer(t, "user_id", "ok", CASBAN_BAD_ID)
+	lols := banListServer(t, "id", "banned", LOLSBOT_BAD_ID)
+	return map[string]BanProviderConfig{
+		"cas":  {URL: cas.URL + "/check?user_id="},
+		"lols": {URL: lols.URL + "/account?id="},
+	}
+}
+
 func Test_isUserApiBanned(t *testing.T) {
+	setupBanProviders(t, testBanProviders(t))
+
 	type args struct {
 		userid int
 	}
@@ -31,44 +79,133 @@ func Test_isUserApiBanned(t *testing.T) {
 	}
 }
 
-func Test_isUserCasBanned(t *testing.T) {
-	type args struct {
-		userid int
-	}
+func Test_banProviderCheck(t *testing.T) {
+	configs := testBanProviders(t)
 	tests := []struct {
-		name string
-		args args
-		want bool
+		name     string
+		provider string
+		userid   int
+		want     BanResult
 	}{
-		{"CasBanTrue", args{userid: CASBAN_BAD_ID}, true},
-		{"CasBanFalse", args{userid: GOOD_ID}, false},
+		{"CasBanTrue", "cas", CASBAN_BAD_ID, BanResult{Banned: true}},
+		{"CasBanFalse", "cas", GOOD_ID, BanResult{Banned: false}},
+		{"LolsBanTrue", "lols", LOLSBOT_BAD_ID, BanResult{Banned: true, Offenses: 3, Score: 0.9}},
+		{"LolsBanFalse", "lols", GOOD_ID, BanResult{Banned: false}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := isUserCasBanned(tt.args.userid); got != tt.want {
-				t.Errorf("isUserCasBanned() = %v, want %v", got, tt.want)
+			provider, err := newBanProvider(tt.provider, configs[tt.provider])
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := provider.Check(int64(tt.userid))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Check() = %+v, want %+v", got, tt.want)
 			}
 		})
 	}
 }
 
-func Test_isUserLolsBanned(t *testing.T) {
-	type args struct {
-		userid int
+func Test_banProviderWeights(t *testing.T) {
+	configs := testBanProviders(t)
+	disabled := false
+	lols := configs["lols"]
+	lols.Weight = 0.5
+	cas := configs["cas"]
+	cas.Enabled = &disabled
+	setupBanProviders(t, map[string]BanProviderConfig{"cas": cas, "lols": lols})
+
+	if providers := getBanProviders(); len(providers) != 2 {
+		t.Fatalf("providers = %d, want lols and local enabled", len(providers))
 	}
-	tests := []struct {
-		name string
-		args args
-		want bool
-	}{
-		{"LolsBanTrue", args{userid: LOLSBOT_BAD_ID}, true},
-		{"LolsBanFalse", args{userid: GOOD_ID}, false},
+	if isUserApiBanned(CASBAN_BAD_ID) {
+		t.Errorf("isUserApiBanned() = true for disabled provider")
 	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := isUserLolsBanned(tt.args.userid); got != tt.want {
-				t.Errorf("isUserLolsBanned() = %v, want %v", got, tt.want)
-			}
-		})
+	if isUserApiBanned(LOLSBOT_BAD_ID) {
+		t.Errorf("isUserApiBanned() = true for score below 1")
+	}
+}
+
+func Test_banProviderTimeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte(`{"ok": true}`))
+	}))
+	t.Cleanup(slow.Close)
+	setupBanProviders(t, map[string]BanProviderConfig{
+		"cas": {URL: slow.URL + "/check?user_id=", Timeout: 50 * time.Millisecond},
+	})
+
+	if isUserApiBanned(CASBAN_BAD_ID) {
+		t.Errorf("isUserApiBanned() = true after provider timeout")
+	}
+}
+
+func Test_banVerdictCache(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		userid, _ := strconv.Atoi(r.URL.Query().Get("user_id"))
+		json.NewEncoder(w).Encode(map[string]bool{"ok": userid == CASBAN_BAD_ID})
+	}))
+	t.Cleanup(server.Close)
+	positiveTTL, negativeTTL := time.Hour, time.Minute
+	setupBanProviders(t, map[string]BanProviderConfig{
+		"cas": {URL: server.URL + "/check?user_id=", PositiveTTL: &positiveTTL, NegativeTTL: &negativeTTL},
+	})
+
+	for i := 0; i < 3; i++ {
+		if !isUserApiBanned(CASBAN_BAD_ID) || isUserApiBanned(GOOD_ID) {
+			t.Fatalf("isUserApiBanned() returned wrong cached verdict")
+		}
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("requests = %d, want 2 with cached verdicts", got)
+	}
+
+	verdict := cache.GetVerdict("cas", int64(GOOD_ID))
+	if verdict == nil || verdict.Expires.After(time.Now().Add(time.Minute)) {
+		t.Fatalf("negative verdict = %+v, want negative_ttl expiry", verdict)
+	}
+	verdict.Expires = time.Now().Add(-time.Second)
+	cache.SetVerdict(*verdict)
+	isUserApiBanned(GOOD_ID)
+	if got := requests.Load(); got != 3 {
+		t.Errorf("requests = %d, want expired verdict checked again", got)
+	}
+	if pruned := cache.PruneVerdicts(time.Now().Add(2 * time.Hour)); pruned != 2 {
+		t.Errorf("PruneVerdicts() = %d, want 2", pruned)
+	}
+}
+
+func Test_banVerdictCacheOff(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		json.NewEncoder(w).Encode(map[string]bool{"ok": false})
+	}))
+	t.Cleanup(server.Close)
+	config := map[string]BanProviderConfig{}
+	if err := yaml.Unmarshal([]byte("cas:\n  positive_ttl: 0s\n  negative_ttl: 0s\n"), &config); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := config["cas"].NegativeTTL; ttl == nil || *ttl != 0 {
+		t.Fatalf("negative_ttl = %v, want explicit 0", ttl)
+	}
+	cas := config["cas"]
+	cas.URL = server.URL + "/check?user_id="
+	setupBanProviders(t, map[string]BanProviderConfig{"cas": cas})
+
+	for i := 0; i < 3; i++ {
+		isUserApiBanned(GOOD_ID)
+	}
+	if got := requests.Load(); got != 3 {
+		t.Errorf("requests = %d, want every check without cache", got)
+	}
+	if verdict := cache.GetVerdict("cas", int64(GOOD_ID)); verdict != nil {
+		t.Errorf("verdict = %+v, want none cached", verdict)
 	}
 }
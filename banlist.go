@@ -0,0 +1,328 @@
+package main
+
+/*
+ - Users banned in any managed chat are remembered in the local ban list.
+ - The list is one more ban provider, so they are banned on join to other chats too.
+ - Admins add and remove entries, lists are exchanged as CSV or JSON files.
+*/
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/OvyFlash/telegram-bot-api"
+)
+
+// Automatic bans live as long as BanChatMember bans
+const LOCAL_BAN_MONTHS = 11
+
+type LocalBan struct {
+	UserID   int64     `json:"user_id"`
+	Reason   string    `json:"reason,omitempty"`
+	Source   string    `json:"source,omitempty"` //Chat or imported list
+	BannedBy int64     `json:"banned_by,omitempty"`
+	Created  time.Time `json:"created"`
+	Expires  time.Time `json:"expires"` //Zero is forever
+}
+
+func (ban LocalBan) isExpired(now time.Time) bool {
+	return !ban.Expires.IsZero() && !ban.Expires.After(now)
+}
+
+// banUser bans in the chat and remembers the user for other chats, adminID 0 is the bot itself
+func banUser(chatID int64, userID int64, adminID int64, reason string) {
+	BanChatMember(chatID, userID, 0)
+	logModeration(ModerationEntry{Action: "ban", ChatID: chatID, UserID: userID, AdminID: adminID, Reason: reason})
+	if cache.GetBan(userID) != nil {
+		return
+	}
+	bannedBy := adminID
+	if bannedBy == 0 {
+		bannedBy = bot.Self.ID
+	}
+	now := time.Now().UTC()
+	cache.AddBan(LocalBan{
+		UserID:   userID,
+		Reason:   reason,
+		Source:   "chat:" + strconv.FormatInt(chatID, 10),
+		BannedBy: bannedBy,
+		Created:  now,
+		Expires:  now.AddDate(0, LOCAL_BAN_MONTHS, 0),
+	})
+}
+
+// rememberKicked saves permanent bans made by chat admins
+func rememberKicked(member *tgbotapi.ChatMemberUpdated) {
+	if member.From.ID == bot.Self.ID || member.NewChatMember.UntilDate != 0 || member.NewChatMember.User == nil {
+		return
+	}
+	userID := member.NewChatMember.User.ID
+	if cache.GetBan(userID) != nil {
+		return
+	}
+	slog.Info(fmt.Sprintf("User %d banned by %d in chat %d", userID, member.From.ID, member.Chat.ID))
+	cache.AddBan(LocalBan{
+		UserID:   userID,
+		Reason:   "banned by admin",
+		Source:   "chat:" + strconv.FormatInt(member.Chat.ID, 10),
+		BannedBy: member.From.ID,
+		Created:  time.Now().UTC(),
+	})
+}
+
+// localProvider checks the local ban list, verdicts are not cached
+type localProvider struct {
+	name   string
+	weight float64
+}
+
+func (p *localProvider) Name() string {
+	return p.name
+}
+
+func (p *localProvider) Weight() float64 {
+	return p.weight
+}
+
+func (p *localProvider) TTL(banned bool) time.Duration {
+	return 0
+}
+
+func (p *localProvider) Check(userid int64) (BanResult, error) {
+	ban := cache.GetBan(userid)
+	if ban == nil || ban.isExpired(time.Now().UTC()) {
+		return BanResult{}, nil
+	}
+	slog.Debug("User "+strconv.FormatInt(userid, 10)+" is LocalBanned", "ban", ban)
+	return BanResult{Banned: true}, nil
+}
+
+var banCsvHeader = []string{"user_id", "reason", "source", "banned_by", "created", "expires"}
+
+// exportBans dumps not expired bans as csv or json
+func exportBans(format string) ([]byte, error) {
+	now := time.Now().UTC()
+	bans := []LocalBan{}
+	for _, ban := range cache.Bans() {
+		if !ban.isExpired(now) {
+			bans = append(bans, ban)
+		}
+	}
+
+	switch format {
+	case "json":
+		return json.MarshalIndent(bans, "", "  ")
+	case "csv":
+		var buffer bytes.Buffer
+		writer := csv.NewWriter(&buffer)
+		writer.Write(banCsvHeader)
+		for _, ban := range bans {
+			expires := ""
+			if !ban.Expires.IsZero() {
+				expires = ban.Expires.Format(time.RFC3339)
+			}
+			writer.Write([]string{
+				strconv.FormatInt(ban.UserID, 10),
+				ban.Reason,
+				ban.Source,
+				strconv.FormatInt(ban.BannedBy, 10),
+				ban.Created.Format(time.RFC3339),
+				expires,
+			})
+		}
+		writer.Flush()
+		return buffer.Bytes(), writer.Error()
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// parseBans reads csv or json, csv needs the header from export
+func parseBans(data []byte, format string) ([]LocalBan, error) {
+	var bans []LocalBan
+	switch format {
+	case "json":
+		if err := json.Unmarshal(data, &bans); err != nil {
+			return nil, fmt.Errorf("error unmarshalling JSON: %w", err)
+		}
+		return bans, nil
+	case "csv":
+		records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("error reading CSV: %w", err)
+		}
+		if len(records) == 0 {
+			return nil, nil
+		}
+		columns := make(map[string]int)
+		for id, name := range records[0] {
+			columns[strings.TrimSpace(strings.ToLower(name))] = id
+		}
+		if _, ok := columns["user_id"]; !ok {
+			return nil, fmt.Errorf("no user_id column in CSV header")
+		}
+		field := func(record []string, name string) string {
+			if id, ok := columns[name]; ok && id < len(record) {
+				return strings.TrimSpace(record[id])
+			}
+			return ""
+		}
+		for line, record := range records[1:] {
+			var ban LocalBan
+			ban.UserID, err = strconv.ParseInt(field(record, "user_id"), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line+2, err)
+			}
+			ban.Reason = field(record, "reason")
+			ban.Source = field(record, "source")
+			ban.BannedBy, _ = strconv.ParseInt(field(record, "banned_by"), 10, 64)
+			if created := field(record, "created"); created != "" {
+				if ban.Created, err = time.Parse(time.RFC3339, created); err != nil {
+					return nil, fmt.Errorf("line %d: %w", line+2, err)
+				}
+			}
+			if expires := field(record, "expires"); expires != "" {
+				if ban.Expires, err = time.Parse(time.RFC3339, expires); err != nil {
+					return nil, fmt.Errorf("line %d: %w", line+2, err)
+				}
+			}
+			bans = append(bans, ban)
+		}
+		return bans, nil
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// importBans adds new users from the list, existing entries are kept
+func importBans(data []byte, format string, source string) (int, error) {
+	bans, err := parseBans(data, format)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now().UTC()
+	counter := 0
+	for _, ban := range bans {
+		if ban.UserID == 0 || ban.isExpired(now) || cache.GetBan(ban.UserID) != nil {
+			continue
+		}
+		if ban.Source == "" {
+			ban.Source = source
+		}
+		if ban.Created.IsZero() {
+			ban.Created = now
+		}
+		cache.AddBan(ban)
+		counter++
+	}
+	slog.Info(fmt.Sprintf("Imported %d of %d bans from %s", counter, len(bans), source))
+	return counter, nil
+}
+
+// banFormat guesses csv or json by file name, then by content
+func banFormat(name string, data []byte) string {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".csv":
+		return "csv"
+	case ".json":
+		return "json"
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		return "json"
+	}
+	return "csv"
+}
+
+// downloadFile gets file contents from Bot API server
+func downloadFile(fileID string) ([]byte, error) {
+	file, err := bot.GetFile(tgbotapi.FileConfig{FileID: fileID})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.Get(fmt.Sprintf(getFileEndpoint(), bot.Token, file.FilePath))
+	if err != nil {
+		return nil, fmt.Errorf("error downloading file: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error status code: %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// banlistCommand handles /banlist* commands of admins in private chat
+func banlistCommand(command string, message tgbotapi.Message) string {
+	args := strings.Fields(message.CommandArguments())
+	switch command {
+	case "banlist":
+		return fmt.Sprintf("Local ban list: %d users\r\n"+
+			"/banlist_add user_id [reason]\r\n"+
+			"/banlist_remove user_id\r\n"+
+			"/banlist_export [csv|json]\r\n"+
+			"/banlist_import as a reply to CSV or JSON file", len(cache.Bans()))
+	case "banlist_add":
+		if len(args) == 0 {
+			return "Usage: /banlist_add user_id [reason]"
+		}
+		userID, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return "Wrong user id: " + args[0]
+		}
+		cache.AddBan(LocalBan{
+			UserID:   userID,
+			Reason:   strings.Join(args[1:], " "),
+			Source:   "admin",
+			BannedBy: message.From.ID,
+			Created:  time.Now().UTC(),
+		})
+		return fmt.Sprintf("User %d added to ban list", userID)
+	case "banlist_remove":
+		if len(args) == 0 {
+			return "Usage: /banlist_remove user_id"
+		}
+		userID, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return "Wrong user id: " + args[0]
+		}
+		if !cache.RemoveBan(userID) {
+			return fmt.Sprintf("User %d is not in ban list", userID)
+		}
+		return fmt.Sprintf("User %d removed from ban list", userID)
+	case "banlist_export":
+		format := "json"
+		if len(args) > 0 {
+			format = strings.ToLower(args[0])
+		}
+		data, err := exportBans(format)
+		if err != nil {
+			return err.Error()
+		}
+		document := tgbotapi.NewDocument(message.Chat.ID, tgbotapi.FileBytes{Name: "banlist." + format, Bytes: data})
+		if _, err := bot.Send(document); err != nil {
+			return err.Error()
+		}
+		return ""
+	case "banlist_import":
+		if message.ReplyToMessage == nil || message.ReplyToMessage.Document == nil {
+			return "Reply with /banlist_import to CSV or JSON file"
+		}
+		document := message.ReplyToMessage.Document
+		data, err := downloadFile(document.FileID)
+		if err != nil {
+			return err.Error()
+		}
+		counter, err := importBans(data, banFormat(document.FileName, data), document.FileName)
+		if err != nil {
+			return err.Error()
+		}
+		return fmt.Sprintf("Imported %d users", counter)
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setupBanList(t *testing.T) {
+	store, err := newJsonStore(filepath.Join(t.TempDir(), "cache.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache = store
+}
+
+func Test_banListExportImport(t *testing.T) {
+	created := time.Now().UTC().Truncate(time.Second)
+	bans := []LocalBan{
+		{UserID: 1, Reason: "spam, ads", Source: "chat:-100", BannedBy: 10, Created: created},
+		{UserID: 2, Reason: "bad name", Source: "chat:-200", Created: created.Add(time.Second), Expires: created.Add(time.Hour)},
+	}
+	for _, format := range []string{"csv", "json"} {
+		t.Run(format, func(t *testing.T) {
+			setupBanList(t)
+			for _, ban := range bans {
+				cache.AddBan(ban)
+			}
+			cache.AddBan(LocalBan{UserID: 3, Created: created, Expires: created.Add(-time.Hour)})
+
+			data, err := exportBans(format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := banFormat("", data); got != format {
+				t.Errorf("banFormat() = %s, want %s", got, format)
+			}
+
+			setupBanList(t)
+			cache.AddBan(LocalBan{UserID: 1, Reason: "kept", Created: created})
+			counter, err := importBans(data, format, "friends."+format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if counter != 1 {
+				t.Errorf("importBans() = %d, want only new not expired users", counter)
+			}
+			if got := cache.GetBan(1); got == nil || got.Reason != "kept" {
+				t.Errorf("GetBan(1) = %+v, want existing entry kept", got)
+			}
+			if got := cache.GetBan(2); got == nil || *got != bans[1] {
+				t.Errorf("GetBan(2) = %+v, want %+v", got, bans[1])
+			}
+		})
+	}
+}
+
+func Test_banListImportCsv(t *testing.T) {
+	setupBanList(t)
+
+	counter, err := importBans([]byte("user_id,reason\n5,spam\n6,\n"), "csv", "list.csv")
+	if err != nil || counter != 2 {
+		t.Fatalf("importBans() = %d, %v, want 2 users", counter, err)
+	}
+	if got := cache.GetBan(5); got == nil || got.Source != "list.csv" || !got.Expires.IsZero() {
+		t.Errorf("GetBan() = %+v, want forever ban from list.csv", got)
+	}
+
+	if _, err := importBans([]byte("id,reason\n5,spam\n"), "csv", "list.csv"); err == nil || !strings.Contains(err.Error(), "user_id") {
+		t.Errorf("importBans() error = %v, want missing user_id column", err)
+	}
+	if _, err := importBans([]byte("user_id\nabc\n"), "csv", "list.csv"); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("importBans() error = %v, want bad line", err)
+	}
+}
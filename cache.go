@@ -6,118 +6,741 @@ import (
 	"log"
 	"log/slog"
 	"os"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 )
 
+// Store keeps bot state between restarts.
+// Implementations must be safe for concurrent use, every method is atomic.
+type Store interface {
+	// Members who got welcome message
+	Members() []ChatMember
+	GetMember(userID int64, chatID int64) *ChatMember
+	// AddMember returns false if member is already in this chat
+	AddMember(member ChatMember) bool
+	RemoveMember(userID int64, chatID int64)
+	ClearMembers()
+
+	// Welcome messages to delete
+	WelcomeQueue() []WelcomeMessage
+	AddWelcome(message WelcomeMessage)
+	UpdateWelcome(message WelcomeMessage)
+	GetWelcome(chatID int64, messageID int) *WelcomeMessage
+	GetUserWelcome(userID int64, chatID int64) *WelcomeMessage
+	RemoveWelcomeByUser(userID int64, chatID int64)
+	PopExpiredWelcomes(now time.Time) []WelcomeMessage
+
+	// Trigger messages to delete, left by older versions, see migrateQueues
+	TriggerQueue() []WelcomeMessage
+	AddTrigger(message WelcomeMessage)
+	PopExpiredTriggers(now time.Time) []WelcomeMessage
+
+	// Ban provider verdicts
+	GetVerdict(provider string, userID int64) *BanVerdict
+	SetVerdict(verdict BanVerdict)
+	PruneVerdicts(now time.Time) int
+
+	// Local ban list
+	Bans() []LocalBan
+	GetBan(userID int64) *LocalBan
+	AddBan(ban LocalBan)
+	// RemoveBan returns false if user was not banned
+	RemoveBan(userID int64) bool
+	PruneBans(now time.Time) int
+
+	// Message stats for ranks, members are kept here until they leave
+	GetStats(userID int64, chatID int64) *ChatMember
+	// AddMessage counts the message for all-time and daily stats, returns all-time stats
+	AddMessage(userID int64, chatID int64, at time.Time) ChatMember
+	SetStats(stats ChatMember)
+	// TopStats sums messages since the day of `since`, zero time is all-time
+	TopStats(chatID int64, since time.Time, limit int) []ChatMember
+	PruneDailyStats(before time.Time) int
+
+	// Username index, usernames are lowercase
+	GetUserID(username string) int64
+	SetUsername(username string, userID int64)
+
+	// Scheduled jobs, AddJob returns the job with a new ID
+	Jobs() []Job
+	AddJob(job Job) Job
+	RemoveJob(id int64)
+
+	// Warnings ledger, Warnings returns active ones, oldest first
+	Warnings(userID int64, chatID int64, now time.Time) []Warning
+	AddWarning(warning Warning)
+	PruneWarnings(now time.Time) int
+
+	LastChanged() int64
+	SetLastChanged(timestamp int64)
+
+	Save() error
+	Close() error
+}
+
+const CACHE_FILE = "cache.json"
+
+// Daily stats are kept for weekly top
+const STATS_DAYS = 7
+
 type Cache struct {
 	Member            []ChatMember
-	DeleteList        []WelcomeMessage `json:"DeleteList,omitempty"`
-	DeleteTriggerList []WelcomeMessage `json:"DeleteTriggerList,omitempty"`
-	LastChanged       int64            `json:"last_changed"`
+	DeleteList        []WelcomeMessage      `json:"DeleteList,omitempty"`
+	DeleteTriggerList []WelcomeMessage      `json:"DeleteTriggerList,omitempty"`
+	Verdicts          map[string]BanVerdict `json:"verdicts,omitempty"` //provider:userid
+	Bans              map[int64]LocalBan    `json:"bans,omitempty"`
+	Usernames         map[string]int64      `json:"usernames,omitempty"`
+	Stats             map[string]ChatMember `json:"stats,omitempty"`       //chatid:userid
+	DailyStats        map[string]DailyStats `json:"daily_stats,omitempty"` //day:chatid:userid
+	Jobs              []Job                 `json:"jobs,omitempty"`
+	Warnings          []Warning             `json:"warnings,omitempty"`
+	LastChanged       int64                 `json:"last_changed"`
 }
 
 type ChatMember struct {
-	Id            int64 `json:"id"`
-	WelcomeShowed bool  `json:"welcome"`
-	Rank          int   `json:"rank"`
-	MessageCount  int   `json:"count"`
-	ChatId        int64 `default:"-1001164690983" json:"chat_id"`
+	Id            int64     `json:"id"`
+	WelcomeShowed bool      `json:"welcome"`
+	Rank          int       `json:"rank"`
+	MessageCount  int       `json:"count"`
+	ChatId        int64     `json:"chat_id"`
+	LastMessage   time.Time `json:"last_message,omitempty"` //Last counted message
+	Joined        time.Time `json:"joined,omitempty"`       //Zero if join was not seen
+	Tier          int       `json:"tier,omitempty"`         //Applied rights tier
+	MediaFrozen   bool      `json:"media_frozen,omitempty"` //Text-only rights by ban policy, tiers are not applied
 }
 
-var (
-	cache     Cache
-	dataMutex sync.RWMutex
-)
+// DailyStats counts messages of one UTC day
+type DailyStats struct {
+	Day    int64 `json:"day"` //Days since unix epoch
+	ChatID int64 `json:"chat_id"`
+	UserID int64 `json:"user_id"`
+	Count  int   `json:"count"`
+}
+
+func statsDay(at time.Time) int64 {
+	return at.Unix() / int64(24*time.Hour/time.Second)
+}
+
+var cache Store
 
-func loadCache() error {
-	dataMutex.Lock()
-	defer dataMutex.Unlock()
+// jsonStore keeps everything in memory and dumps it to a single json file.
+type jsonStore struct {
+	mu    sync.RWMutex
+	path  string
+	data  Cache
+	dirty bool
+}
+
+func newJsonStore(path string) (*jsonStore, error) {
+	store := &jsonStore{path: path}
+	return store, store.load()
+}
 
-	file, err := os.ReadFile("cache.json")
+func (s *jsonStore) load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.ReadFile(s.path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			log.Println("No cache file.")
 			// Create empty data if file doesn't exist
-			cache = Cache{}
+			s.data = Cache{}
 			return nil
 		}
-		return fmt.Errorf("error reading cache.json: %v", err)
+		return fmt.Errorf("error reading %s: %v", s.path, err)
 	}
 
-	err = json.Unmarshal(file, &cache)
+	err = json.Unmarshal(file, &s.data)
 	if err != nil {
-		return fmt.Errorf("error unmarshalling cache.json: %v", err)
+		return fmt.Errorf("error unmarshalling %s: %v", s.path, err)
 	}
 	return nil
 }
 
-func saveCache() error {
-	dataMutex.Lock()
-	defer dataMutex.Unlock()
+func (s *jsonStore) changed() {
+	s.dirty = true
+	s.data.LastChanged = time.Now().Unix()
+}
+
+// Save writes the file only if something was changed since the last save
+func (s *jsonStore) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	file, err := json.MarshalIndent(cache, "", "  ")
+	if !s.dirty {
+		return nil
+	}
+
+	file, err := json.MarshalIndent(s.data, "", "  ")
 	if err != nil {
 		return fmt.Errorf("error marshalling data: %v", err)
 	}
 
-	err = os.WriteFile("cache.json", file, 0644)
+	err = os.WriteFile(s.path, file, 0644)
 	if err != nil {
-		return fmt.Errorf("error saving data to cache.json: %v", err)
+		return fmt.Errorf("error saving data to %s: %v", s.path, err)
 	}
+	s.dirty = false
 	return nil
 }
 
-func importCache() (bool, error) {
-	err := loadCache()
-	if err != nil {
-		fmt.Println("Error loading data:", err)
+func (s *jsonStore) Close() error {
+	return s.Save()
+}
+
+func (s *jsonStore) Members() []ChatMember {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]ChatMember(nil), s.data.Member...)
+}
+
+func (s *jsonStore) GetMember(userID int64, chatID int64) *ChatMember {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, member := range s.data.Member {
+		if member.Id == userID && member.ChatId == chatID {
+			current := member
+			return &current
+		}
 	}
+	return nil
+}
 
-	slog.Info("Last changed:", "cache", cache.LastChanged)
-	cache.LastChanged = time.Now().Unix()
-	return true, nil
+func (s *jsonStore) AddMember(member ChatMember) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, current := range s.data.Member {
+		if current.Id == member.Id && current.ChatId == member.ChatId {
+			return false
+		}
+	}
+	s.data.Member = append(s.data.Member, member)
+	s.changed()
+	return true
 }
 
-func syncData() {
-	for {
-		// Update last_changed regardless of import status
-		cache.LastChanged = time.Now().Unix()
+func (s *jsonStore) RemoveMember(userID int64, chatID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var retained []ChatMember
+	for _, member := range s.data.Member {
+		if member.Id != userID || member.ChatId != chatID {
+			retained = append(retained, member)
+		}
+	}
+	s.data.Member = retained
+	s.changed()
+}
 
-		if err := saveCache(); err != nil {
-			fmt.Println("Error saving data:", err)
+func (s *jsonStore) ClearMembers() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Member = nil
+	s.changed()
+}
+
+func (s *jsonStore) WelcomeQueue() []WelcomeMessage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]WelcomeMessage(nil), s.data.DeleteList...)
+}
+
+func (s *jsonStore) AddWelcome(message WelcomeMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.DeleteList = append(s.data.DeleteList, message)
+	s.changed()
+}
+
+func (s *jsonStore) UpdateWelcome(message WelcomeMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, welcome := range s.data.DeleteList {
+		if welcome.ChatID == message.ChatID && welcome.ID == message.ID {
+			s.data.DeleteList[id] = message
+			s.changed()
+			return
 		}
-		time.Sleep(1 * time.Minute)
 	}
 }
 
-func getMember(memberId int64) (member *ChatMember) {
-	for _, member := range cache.Member {
-		if member.Id == memberId {
-			current := member
+func (s *jsonStore) GetWelcome(chatID int64, messageID int) *WelcomeMessage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, welcome := range s.data.DeleteList {
+		if welcome.ChatID == chatID && welcome.ID == messageID {
+			current := welcome
 			return &current
 		}
 	}
 	return nil
 }
 
-func clearCachedUser(userid int64) {
-	for id, member := range cache.Member {
-		if member.Id == userid {
-			cache.Member = append(cache.Member[:id], cache.Member[id+1:]...)
-			break
+func (s *jsonStore) GetUserWelcome(userID int64, chatID int64) *WelcomeMessage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, welcome := range s.data.DeleteList {
+		if welcome.UserID == userID && welcome.ChatID == chatID {
+			current := welcome
+			return &current
+		}
+	}
+	return nil
+}
+
+func (s *jsonStore) RemoveWelcomeByUser(userID int64, chatID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.DeleteList, _ = splitMessages(s.data.DeleteList, func(welcome WelcomeMessage) bool {
+		return welcome.UserID == userID && welcome.ChatID == chatID
+	})
+	s.changed()
+}
+
+func (s *jsonStore) PopExpiredWelcomes(now time.Time) []WelcomeMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var expired []WelcomeMessage
+	s.data.DeleteList, expired = splitMessages(s.data.DeleteList, func(welcome WelcomeMessage) bool {
+		return welcome.Timestamp.Before(now)
+	})
+	if len(expired) > 0 {
+		s.changed()
+	}
+	return expired
+}
+
+func (s *jsonStore) TriggerQueue() []WelcomeMessage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]WelcomeMessage(nil), s.data.DeleteTriggerList...)
+}
+
+func (s *jsonStore) AddTrigger(message WelcomeMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.DeleteTriggerList = append(s.data.DeleteTriggerList, message)
+	s.changed()
+}
+
+func (s *jsonStore) PopExpiredTriggers(now time.Time) []WelcomeMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var expired []WelcomeMessage
+	s.data.DeleteTriggerList, expired = splitMessages(s.data.DeleteTriggerList, func(trigger WelcomeMessage) bool {
+		return trigger.Timestamp.Before(now)
+	})
+	if len(expired) > 0 {
+		s.changed()
+	}
+	return expired
+}
+
+func verdictKey(provider string, userID int64) string {
+	return provider + ":" + strconv.FormatInt(userID, 10)
+}
+
+func (s *jsonStore) GetVerdict(provider string, userID int64) *BanVerdict {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	verdict, ok := s.data.Verdicts[verdictKey(provider, userID)]
+	if !ok {
+		return nil
+	}
+	return &verdict
+}
+
+func (s *jsonStore) SetVerdict(verdict BanVerdict) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.Verdicts == nil {
+		s.data.Verdicts = make(map[string]BanVerdict)
+	}
+	s.data.Verdicts[verdictKey(verdict.Provider, verdict.UserID)] = verdict
+	s.changed()
+}
+
+func (s *jsonStore) PruneVerdicts(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counter := 0
+	for key, verdict := range s.data.Verdicts {
+		if !verdict.Expires.After(now) {
+			delete(s.data.Verdicts, key)
+			counter++
+		}
+	}
+	if counter > 0 {
+		s.changed()
+	}
+	return counter
+}
+
+func (s *jsonStore) Bans() []LocalBan {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	bans := make([]LocalBan, 0, len(s.data.Bans))
+	for _, ban := range s.data.Bans {
+		bans = append(bans, ban)
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Created.Before(bans[j].Created)
+	})
+	return bans
+}
+
+func (s *jsonStore) GetBan(userID int64) *LocalBan {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ban, ok := s.data.Bans[userID]
+	if !ok {
+		return nil
+	}
+	return &ban
+}
+
+func (s *jsonStore) AddBan(ban LocalBan) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.Bans == nil {
+		s.data.Bans = make(map[int64]LocalBan)
+	}
+	s.data.Bans[ban.UserID] = ban
+	s.changed()
+}
+
+func (s *jsonStore) RemoveBan(userID int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.data.Bans[userID]; !ok {
+		return false
+	}
+	delete(s.data.Bans, userID)
+	s.changed()
+	return true
+}
+
+func (s *jsonStore) PruneBans(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counter := 0
+	for userID, ban := range s.data.Bans {
+		if ban.isExpired(now) {
+			delete(s.data.Bans, userID)
+			counter++
 		}
 	}
+	if counter > 0 {
+		s.changed()
+	}
+	return counter
+}
+
+func statsKey(userID int64, chatID int64) string {
+	return strconv.FormatInt(chatID, 10) + ":" + strconv.FormatInt(userID, 10)
+}
+
+func (s *jsonStore) GetStats(userID int64, chatID int64) *ChatMember {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stats, ok := s.data.Stats[statsKey(userID, chatID)]
+	if !ok {
+		return nil
+	}
+	return &stats
+}
+
+func (s *jsonStore) AddMessage(userID int64, chatID int64, at time.Time) ChatMember {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.Stats == nil {
+		s.data.Stats = make(map[string]ChatMember)
+	}
+	key := statsKey(userID, chatID)
+	stats, ok := s.data.Stats[key]
+	if !ok {
+		stats = ChatMember{Id: userID, ChatId: chatID}
+	}
+	stats.MessageCount++
+	stats.LastMessage = at
+	s.data.Stats[key] = stats
+
+	if s.data.DailyStats == nil {
+		s.data.DailyStats = make(map[string]DailyStats)
+	}
+	day := statsDay(at)
+	dailyKey := strconv.FormatInt(day, 10) + ":" + key
+	daily, ok := s.data.DailyStats[dailyKey]
+	if !ok {
+		daily = DailyStats{Day: day, ChatID: chatID, UserID: userID}
+	}
+	daily.Count++
+	s.data.DailyStats[dailyKey] = daily
+	s.changed()
+	return stats
 }
 
-func clearDeleteListByUser(userid int64) {
-	for id, message := range cache.DeleteList {
-		if message.UserID == userid {
-			if len(cache.DeleteList) == 1 {
-				cache.DeleteList = nil
-			} else {
-				cache.DeleteList = append(cache.DeleteList[:id], cache.DeleteList[id+1:]...)
+func (s *jsonStore) SetStats(stats ChatMember) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.Stats == nil {
+		s.data.Stats = make(map[string]ChatMember)
+	}
+	s.data.Stats[statsKey(stats.Id, stats.ChatId)] = stats
+	s.changed()
+}
+
+func (s *jsonStore) TopStats(chatID int64, since time.Time, limit int) []ChatMember {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var members []ChatMember
+	if since.IsZero() {
+		for _, stats := range s.data.Stats {
+			if stats.ChatId == chatID {
+				members = append(members, stats)
 			}
 		}
+	} else {
+		counts := make(map[int64]int)
+		for _, daily := range s.data.DailyStats {
+			if daily.ChatID == chatID && daily.Day >= statsDay(since) {
+				counts[daily.UserID] += daily.Count
+			}
+		}
+		for userID, count := range counts {
+			members = append(members, ChatMember{Id: userID, ChatId: chatID, MessageCount: count})
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].MessageCount != members[j].MessageCount {
+			return members[i].MessageCount > members[j].MessageCount
+		}
+		return members[i].Id < members[j].Id
+	})
+	return members[:min(limit, len(members))]
+}
+
+func (s *jsonStore) PruneDailyStats(before time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counter := 0
+	for key, daily := range s.data.DailyStats {
+		if daily.Day < statsDay(before) {
+			delete(s.data.DailyStats, key)
+			counter++
+		}
+	}
+	if counter > 0 {
+		s.changed()
+	}
+	return counter
+}
+
+func (s *jsonStore) GetUserID(username string) int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.Usernames[username]
+}
+
+func (s *jsonStore) SetUsername(username string, userID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.Usernames == nil {
+		s.data.Usernames = make(map[string]int64)
+	}
+	s.data.Usernames[username] = userID
+	s.changed()
+}
+
+func (s *jsonStore) Jobs() []Job {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Job(nil), s.data.Jobs...)
+}
+
+func (s *jsonStore) AddJob(job Job) Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job.ID = 1
+	for _, existing := range s.data.Jobs {
+		job.ID = max(job.ID, existing.ID+1)
+	}
+	s.data.Jobs = append(s.data.Jobs, job)
+	s.changed()
+	return job
+}
+
+func (s *jsonStore) RemoveJob(id int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, job := range s.data.Jobs {
+		if job.ID == id {
+			s.data.Jobs = append(s.data.Jobs[:i], s.data.Jobs[i+1:]...)
+			s.changed()
+			return
+		}
+	}
+}
+
+func (s *jsonStore) Warnings(userID int64, chatID int64, now time.Time) []Warning {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var warnings []Warning
+	for _, warning := range s.data.Warnings {
+		if warning.UserID == userID && warning.ChatID == chatID && !warning.isExpired(now) {
+			warnings = append(warnings, warning)
+		}
+	}
+	return warnings
+}
+
+func (s *jsonStore) AddWarning(warning Warning) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Warnings = append(s.data.Warnings, warning)
+	s.changed()
+}
+
+func (s *jsonStore) PruneWarnings(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var retained []Warning
+	for _, warning := range s.data.Warnings {
+		if !warning.isExpired(now) {
+			retained = append(retained, warning)
+		}
+	}
+	counter := len(s.data.Warnings) - len(retained)
+	if counter > 0 {
+		s.data.Warnings = retained
+		s.changed()
+	}
+	return counter
+}
+
+func (s *jsonStore) LastChanged() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.LastChanged
+}
+
+func (s *jsonStore) SetLastChanged(timestamp int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.LastChanged = timestamp
+	s.dirty = true
+}
+
+// splitMessages returns messages which don't match and which match
+func splitMessages(messages []WelcomeMessage, match func(WelcomeMessage) bool) (retained []WelcomeMessage, matched []WelcomeMessage) {
+	for _, message := range messages {
+		if match(message) {
+			matched = append(matched, message)
+		} else {
+			retained = append(retained, message)
+		}
+	}
+	return retained, matched
+}
+
+func openStore() (Store, error) {
+	switch MainConfig.Storage {
+	case "", "json":
+		return newJsonStore(MainConfig.StoragePath)
+	case "sqlite":
+		store, err := newSQLiteStore(MainConfig.StoragePath)
+		if err != nil {
+			return nil, err
+		}
+		if err := migrateJsonCache(store); err != nil {
+			store.Close()
+			return nil, err
+		}
+		return store, nil
+	}
+	return nil, fmt.Errorf("unknown storage %q", MainConfig.Storage)
+}
+
+// migrateJsonCache moves existing cache.json into the store once.
+// The file is renamed afterwards, so it will not be imported again.
+func migrateJsonCache(store Store) error {
+	if _, err := os.Stat(CACHE_FILE); err != nil {
+		return nil
+	}
+	old, err := newJsonStore(CACHE_FILE)
+	if err != nil {
+		return err
+	}
+
+	for _, member := range old.Members() {
+		store.AddMember(member)
+	}
+	for _, message := range old.WelcomeQueue() {
+		store.AddWelcome(message)
+	}
+	for _, message := range old.TriggerQueue() {
+		store.AddTrigger(message)
+	}
+	for _, verdict := range old.data.Verdicts {
+		store.SetVerdict(verdict)
+	}
+	for _, ban := range old.data.Bans {
+		store.AddBan(ban)
+	}
+	for username, userID := range old.data.Usernames {
+		store.SetUsername(username, userID)
+	}
+	for _, stats := range old.data.Stats {
+		store.SetStats(stats)
+	}
+	for _, job := range old.data.Jobs {
+		store.AddJob(job)
+	}
+	for _, warning := range old.data.Warnings {
+		store.AddWarning(warning)
+	}
+	// Daily stats are not migrated, they expire in a week
+	store.SetLastChanged(old.LastChanged())
+
+	slog.Info(fmt.Sprintf("Migrated %s: %d members, %d welcome, %d trigger messages",
+		CACHE_FILE, len(old.data.Member), len(old.data.DeleteList), len(old.data.DeleteTriggerList)))
+	return os.Rename(CACHE_FILE, CACHE_FILE+".migrated")
+}
+
+func importCache() (bool, error) {
+	if MainConfig.StoragePath == "" {
+		MainConfig.StoragePath = CACHE_FILE
+		if MainConfig.Storage == "sqlite" {
+			MainConfig.StoragePath = "cache.db"
+		}
+	}
+
+	store, err := openStore()
+	if err != nil {
+		fmt.Println("Error loading data:", err)
+		if store == nil {
+			log.Panic(err)
+		}
+	}
+	cache = store
+
+	slog.Info("Last changed:", "cache", cache.LastChanged())
+	cache.SetLastChanged(time.Now().Unix())
+	return true, nil
+}
+
+func syncData() {
+	for {
+		cache.PruneVerdicts(time.Now().UTC())
+		cache.PruneBans(time.Now().UTC())
+		cache.PruneDailyStats(time.Now().UTC().AddDate(0, 0, -STATS_DAYS))
+		cache.PruneWarnings(time.Now().UTC())
+		if err := cache.Save(); err != nil {
+			fmt.Println("Error saving data:", err)
+		}
+		time.Sleep(1 * time.Minute)
 	}
 }
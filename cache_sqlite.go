@@ -0,0 +1,619 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS members (
+	user_id  INTEGER NOT NULL,
+	chat_id  INTEGER NOT NULL,
+	welcome  INTEGER NOT NULL DEFAULT 0,
+	rank     INTEGER NOT NULL DEFAULT 0,
+	count    INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (user_id, chat_id)
+);
+CREATE INDEX IF NOT EXISTS members_chat ON members (chat_id);
+
+CREATE TABLE IF NOT EXISTS welcome_queue (
+	chat_id    INTEGER NOT NULL,
+	message_id INTEGER NOT NULL,
+	user_id    INTEGER NOT NULL,
+	expires    INTEGER NOT NULL,
+	PRIMARY KEY (chat_id, message_id)
+);
+CREATE INDEX IF NOT EXISTS welcome_queue_user_chat ON welcome_queue (user_id, chat_id);
+CREATE INDEX IF NOT EXISTS welcome_queue_expires ON welcome_queue (expires);
+
+CREATE TABLE IF NOT EXISTS trigger_queue (
+	chat_id    INTEGER NOT NULL,
+	message_id INTEGER NOT NULL,
+	user_id    INTEGER NOT NULL,
+	expires    INTEGER NOT NULL,
+	PRIMARY KEY (chat_id, message_id)
+);
+CREATE INDEX IF NOT EXISTS trigger_queue_expires ON trigger_queue (expires);
+
+CREATE TABLE IF NOT EXISTS ban_verdicts (
+	provider TEXT    NOT NULL,
+	user_id  INTEGER NOT NULL,
+	banned   INTEGER NOT NULL,
+	offenses INTEGER NOT NULL DEFAULT 0,
+	score    REAL    NOT NULL DEFAULT 0,
+	expires  INTEGER NOT NULL,
+	PRIMARY KEY (provider, user_id)
+);
+CREATE INDEX IF NOT EXISTS ban_verdicts_expires ON ban_verdicts (expires);
+
+CREATE TABLE IF NOT EXISTS local_bans (
+	user_id   INTEGER PRIMARY KEY,
+	reason    TEXT    NOT NULL DEFAULT '',
+	source    TEXT    NOT NULL DEFAULT '',
+	banned_by INTEGER NOT NULL DEFAULT 0,
+	created   INTEGER NOT NULL,
+	expires   INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS usernames (
+	username TEXT PRIMARY KEY,
+	user_id  INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS stats (
+	user_id      INTEGER NOT NULL,
+	chat_id      INTEGER NOT NULL,
+	rank         INTEGER NOT NULL DEFAULT 0,
+	count        INTEGER NOT NULL DEFAULT 0,
+	last_message INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (chat_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS daily_stats (
+	day     INTEGER NOT NULL,
+	chat_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	count   INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (chat_id, day, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS jobs (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	kind       TEXT    NOT NULL,
+	chat_id    INTEGER NOT NULL DEFAULT 0,
+	user_id    INTEGER NOT NULL DEFAULT 0,
+	message_id INTEGER NOT NULL DEFAULT 0,
+	text       TEXT    NOT NULL DEFAULT '',
+	due        INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS warnings (
+	id       INTEGER PRIMARY KEY AUTOINCREMENT,
+	chat_id  INTEGER NOT NULL,
+	user_id  INTEGER NOT NULL,
+	admin_id INTEGER NOT NULL DEFAULT 0,
+	reason   TEXT    NOT NULL DEFAULT '',
+	created  INTEGER NOT NULL,
+	expires  INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS warnings_user ON warnings (chat_id, user_id);
+
+CREATE TABLE IF NOT EXISTS meta (
+	key   TEXT PRIMARY KEY,
+	value INTEGER NOT NULL
+);
+`
+
+// sqliteMigrations upgrade existing databases, applied version is kept in user_version.
+// Append only, never edit applied migrations.
+var sqliteMigrations = []string{
+	`ALTER TABLE welcome_queue ADD COLUMN answer TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE stats ADD COLUMN joined INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE stats ADD COLUMN tier INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE welcome_queue ADD COLUMN challenge TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE welcome_queue ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE welcome_queue ADD COLUMN join_chat INTEGER NOT NULL DEFAULT 0`,
+	`DROP INDEX IF EXISTS welcome_queue_user`,
+	`ALTER TABLE stats ADD COLUMN media_frozen INTEGER NOT NULL DEFAULT 0`,
+}
+
+// Columns read by scanMessages, trigger queue has no answers
+const welcomeColumns = `chat_id, message_id, user_id, expires, answer, challenge, attempts, join_chat`
+const triggerColumns = `chat_id, message_id, user_id, expires, '', '', 0, 0`
+
+// sqliteStore writes every change immediately, Save is a no-op.
+// database/sql is safe for concurrent use, queue pops run in transactions.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+func newSQLiteStore(path string) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %v", path, err)
+	}
+	// One connection is enough for the bot and avoids "database is locked"
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating schema in %s: %v", path, err)
+	}
+	if err := migrateSQLite(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error migrating %s: %v", path, err)
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+func migrateSQLite(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	for ; version < len(sqliteMigrations); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(sqliteMigrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %v", version+1, err)
+		}
+		// PRAGMA doesn't accept parameters
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqliteStore) exec(query string, args ...any) {
+	if _, err := s.db.Exec(query, args...); err != nil {
+		slog.Warn("SQLite error:", "error", err, "query", query)
+	}
+}
+
+func (s *sqliteStore) Save() error {
+	return nil
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *sqliteStore) queryMembers(query string, args ...any) []ChatMember {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		slog.Warn("SQLite error:", "error", err, "query", query)
+		return nil
+	}
+	defer rows.Close()
+
+	var members []ChatMember
+	for rows.Next() {
+		var member ChatMember
+		if err := rows.Scan(&member.Id, &member.ChatId, &member.WelcomeShowed, &member.Rank, &member.MessageCount); err != nil {
+			slog.Warn("SQLite error:", "error", err)
+			continue
+		}
+		members = append(members, member)
+	}
+	return members
+}
+
+func (s *sqliteStore) Members() []ChatMember {
+	return s.queryMembers(`SELECT user_id, chat_id, welcome, rank, count FROM members ORDER BY rowid`)
+}
+
+func (s *sqliteStore) GetMember(userID int64, chatID int64) *ChatMember {
+	members := s.queryMembers(`SELECT user_id, chat_id, welcome, rank, count FROM members WHERE user_id = ? AND chat_id = ?`, userID, chatID)
+	if len(members) == 0 {
+		return nil
+	}
+	return &members[0]
+}
+
+func (s *sqliteStore) AddMember(member ChatMember) bool {
+	result, err := s.db.Exec(`INSERT OR IGNORE INTO members (user_id, chat_id, welcome, rank, count) VALUES (?, ?, ?, ?, ?)`,
+		member.Id, member.ChatId, member.WelcomeShowed, member.Rank, member.MessageCount)
+	if err != nil {
+		slog.Warn("SQLite error:", "error", err)
+		return false
+	}
+	added, _ := result.RowsAffected()
+	return added > 0
+}
+
+func (s *sqliteStore) RemoveMember(userID int64, chatID int64) {
+	s.exec(`DELETE FROM members WHERE user_id = ? AND chat_id = ?`, userID, chatID)
+}
+
+func (s *sqliteStore) ClearMembers() {
+	s.exec(`DELETE FROM members`)
+}
+
+func (s *sqliteStore) queryMessages(query string, args ...any) []WelcomeMessage {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		slog.Warn("SQLite error:", "error", err, "query", query)
+		return nil
+	}
+	return scanMessages(rows)
+}
+
+func scanMessages(rows *sql.Rows) []WelcomeMessage {
+	defer rows.Close()
+
+	var messages []WelcomeMessage
+	for rows.Next() {
+		var message WelcomeMessage
+		var expires int64
+		if err := rows.Scan(&message.ChatID, &message.ID, &message.UserID, &expires, &message.Answer, &message.Challenge, &message.Attempts, &message.JoinChat); err != nil {
+			slog.Warn("SQLite error:", "error", err)
+			continue
+		}
+		message.Timestamp = time.Unix(expires, 0).UTC()
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+func (s *sqliteStore) WelcomeQueue() []WelcomeMessage {
+	return s.queryMessages(`SELECT ` + welcomeColumns + ` FROM welcome_queue ORDER BY expires`)
+}
+
+func (s *sqliteStore) AddWelcome(message WelcomeMessage) {
+	s.exec(`INSERT OR REPLACE INTO welcome_queue (chat_id, message_id, user_id, expires, answer, challenge, attempts, join_chat) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		message.ChatID, message.ID, message.UserID, message.Timestamp.Unix(), message.Answer, message.Challenge, message.Attempts, message.JoinChat)
+}
+
+func (s *sqliteStore) UpdateWelcome(message WelcomeMessage) {
+	s.exec(`UPDATE welcome_queue SET user_id = ?, expires = ?, answer = ?, challenge = ?, attempts = ?, join_chat = ? WHERE chat_id = ? AND message_id = ?`,
+		message.UserID, message.Timestamp.Unix(), message.Answer, message.Challenge, message.Attempts, message.JoinChat, message.ChatID, message.ID)
+}
+
+func (s *sqliteStore) GetWelcome(chatID int64, messageID int) *WelcomeMessage {
+	messages := s.queryMessages(`SELECT `+welcomeColumns+` FROM welcome_queue WHERE chat_id = ? AND message_id = ?`, chatID, messageID)
+	if len(messages) == 0 {
+		return nil
+	}
+	return &messages[0]
+}
+
+func (s *sqliteStore) GetUserWelcome(userID int64, chatID int64) *WelcomeMessage {
+	messages := s.queryMessages(`SELECT `+welcomeColumns+` FROM welcome_queue WHERE user_id = ? AND chat_id = ? ORDER BY expires LIMIT 1`, userID, chatID)
+	if len(messages) == 0 {
+		return nil
+	}
+	return &messages[0]
+}
+
+func (s *sqliteStore) RemoveWelcomeByUser(userID int64, chatID int64) {
+	s.exec(`DELETE FROM welcome_queue WHERE user_id = ? AND chat_id = ?`, userID, chatID)
+}
+
+func (s *sqliteStore) TriggerQueue() []WelcomeMessage {
+	return s.queryMessages(`SELECT ` + triggerColumns + ` FROM trigger_queue ORDER BY expires`)
+}
+
+func (s *sqliteStore) AddTrigger(message WelcomeMessage) {
+	s.exec(`INSERT OR REPLACE INTO trigger_queue (chat_id, message_id, user_id, expires) VALUES (?, ?, ?, ?)`,
+		message.ChatID, message.ID, message.UserID, message.Timestamp.Unix())
+}
+
+func (s *sqliteStore) PopExpiredWelcomes(now time.Time) []WelcomeMessage {
+	return s.popExpired("welcome_queue", welcomeColumns, now)
+}
+
+func (s *sqliteStore) PopExpiredTriggers(now time.Time) []WelcomeMessage {
+	return s.popExpired("trigger_queue", triggerColumns, now)
+}
+
+// popExpired selects and deletes expired messages in one transaction.
+func (s *sqliteStore) popExpired(table string, columns string, now time.Time) []WelcomeMessage {
+	tx, err := s.db.Begin()
+	if err != nil {
+		slog.Warn("SQLite error:", "error", err)
+		return nil
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT `+columns+` FROM `+table+` WHERE expires < ? ORDER BY expires`, now.Unix())
+	if err != nil {
+		slog.Warn("SQLite error:", "error", err)
+		return nil
+	}
+	messages := scanMessages(rows)
+
+	if _, err := tx.Exec(`DELETE FROM `+table+` WHERE expires < ?`, now.Unix()); err != nil {
+		slog.Warn("SQLite error:", "error", err)
+		return nil
+	}
+	if err := tx.Commit(); err != nil {
+		slog.Warn("SQLite error:", "error", err)
+		return nil
+	}
+	return messages
+}
+
+func (s *sqliteStore) GetVerdict(provider string, userID int64) *BanVerdict {
+	verdict := BanVerdict{Provider: provider, UserID: userID}
+	var expires int64
+	err := s.db.QueryRow(`SELECT banned, offenses, score, expires FROM ban_verdicts WHERE provider = ? AND user_id = ?`, provider, userID).
+		Scan(&verdict.Banned, &verdict.Offenses, &verdict.Score, &expires)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			slog.Warn("SQLite error:", "error", err)
+		}
+		return nil
+	}
+	verdict.Expires = time.Unix(expires, 0).UTC()
+	return &verdict
+}
+
+func (s *sqliteStore) SetVerdict(verdict BanVerdict) {
+	s.exec(`INSERT OR REPLACE INTO ban_verdicts (provider, user_id, banned, offenses, score, expires) VALUES (?, ?, ?, ?, ?, ?)`,
+		verdict.Provider, verdict.UserID, verdict.Banned, verdict.Offenses, verdict.Score, verdict.Expires.Unix())
+}
+
+func (s *sqliteStore) PruneVerdicts(now time.Time) int {
+	result, err := s.db.Exec(`DELETE FROM ban_verdicts WHERE expires <= ?`, now.Unix())
+	if err != nil {
+		slog.Warn("SQLite error:", "error", err)
+		return 0
+	}
+	counter, _ := result.RowsAffected()
+	return int(counter)
+}
+
+func (s *sqliteStore) queryBans(query string, args ...any) []LocalBan {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		slog.Warn("SQLite error:", "error", err, "query", query)
+		return nil
+	}
+	defer rows.Close()
+
+	var bans []LocalBan
+	for rows.Next() {
+		var ban LocalBan
+		var created, expires int64
+		if err := rows.Scan(&ban.UserID, &ban.Reason, &ban.Source, &ban.BannedBy, &created, &expires); err != nil {
+			slog.Warn("SQLite error:", "error", err)
+			continue
+		}
+		ban.Created = time.Unix(created, 0).UTC()
+		// 0 is forever
+		if expires != 0 {
+			ban.Expires = time.Unix(expires, 0).UTC()
+		}
+		bans = append(bans, ban)
+	}
+	return bans
+}
+
+func (s *sqliteStore) Bans() []LocalBan {
+	return s.queryBans(`SELECT user_id, reason, source, banned_by, created, expires FROM local_bans ORDER BY created`)
+}
+
+func (s *sqliteStore) GetBan(userID int64) *LocalBan {
+	bans := s.queryBans(`SELECT user_id, reason, source, banned_by, created, expires FROM local_bans WHERE user_id = ?`, userID)
+	if len(bans) == 0 {
+		return nil
+	}
+	return &bans[0]
+}
+
+func (s *sqliteStore) AddBan(ban LocalBan) {
+	var expires int64
+	if !ban.Expires.IsZero() {
+		expires = ban.Expires.Unix()
+	}
+	s.exec(`INSERT OR REPLACE INTO local_bans (user_id, reason, source, banned_by, created, expires) VALUES (?, ?, ?, ?, ?, ?)`,
+		ban.UserID, ban.Reason, ban.Source, ban.BannedBy, ban.Created.Unix(), expires)
+}
+
+func (s *sqliteStore) RemoveBan(userID int64) bool {
+	result, err := s.db.Exec(`DELETE FROM local_bans WHERE user_id = ?`, userID)
+	if err != nil {
+		slog.Warn("SQLite error:", "error", err)
+		return false
+	}
+	removed, _ := result.RowsAffected()
+	return removed > 0
+}
+
+func (s *sqliteStore) PruneBans(now time.Time) int {
+	result, err := s.db.Exec(`DELETE FROM local_bans WHERE expires != 0 AND expires <= ?`, now.Unix())
+	if err != nil {
+		slog.Warn("SQLite error:", "error", err)
+		return 0
+	}
+	counter, _ := result.RowsAffected()
+	return int(counter)
+}
+
+func (s *sqliteStore) queryStats(query string, args ...any) []ChatMember {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		slog.Warn("SQLite error:", "error", err, "query", query)
+		return nil
+	}
+	defer rows.Close()
+
+	var members []ChatMember
+	for rows.Next() {
+		var member ChatMember
+		var lastMessage, joined int64
+		if err := rows.Scan(&member.Id, &member.ChatId, &member.Rank, &member.MessageCount, &lastMessage, &joined, &member.Tier, &member.MediaFrozen); err != nil {
+			slog.Warn("SQLite error:", "error", err)
+			continue
+		}
+		member.LastMessage = time.Unix(lastMessage, 0).UTC()
+		// 0 is unknown
+		if joined != 0 {
+			member.Joined = time.Unix(joined, 0).UTC()
+		}
+		members = append(members, member)
+	}
+	return members
+}
+
+func (s *sqliteStore) GetStats(userID int64, chatID int64) *ChatMember {
+	members := s.queryStats(`SELECT user_id, chat_id, rank, count, last_message, joined, tier, media_frozen FROM stats WHERE user_id = ? AND chat_id = ?`, userID, chatID)
+	if len(members) == 0 {
+		return nil
+	}
+	return &members[0]
+}
+
+func (s *sqliteStore) AddMessage(userID int64, chatID int64, at time.Time) ChatMember {
+	s.exec(`INSERT INTO daily_stats (day, chat_id, user_id, count) VALUES (?, ?, ?, 1)
+		ON CONFLICT (chat_id, day, user_id) DO UPDATE SET count = count + 1`, statsDay(at), chatID, userID)
+	members := s.queryStats(`INSERT INTO stats (user_id, chat_id, count, last_message) VALUES (?, ?, 1, ?)
+		ON CONFLICT (chat_id, user_id) DO UPDATE SET count = count + 1, last_message = excluded.last_message
+		RETURNING user_id, chat_id, rank, count, last_message, joined, tier, media_frozen`, userID, chatID, at.Unix())
+	if len(members) == 0 {
+		return ChatMember{Id: userID, ChatId: chatID, LastMessage: at}
+	}
+	return members[0]
+}
+
+func (s *sqliteStore) SetStats(stats ChatMember) {
+	var joined int64
+	if !stats.Joined.IsZero() {
+		joined = stats.Joined.Unix()
+	}
+	s.exec(`INSERT OR REPLACE INTO stats (user_id, chat_id, rank, count, last_message, joined, tier, media_frozen) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		stats.Id, stats.ChatId, stats.Rank, stats.MessageCount, stats.LastMessage.Unix(), joined, stats.Tier, stats.MediaFrozen)
+}
+
+func (s *sqliteStore) TopStats(chatID int64, since time.Time, limit int) []ChatMember {
+	if since.IsZero() {
+		return s.queryStats(`SELECT user_id, chat_id, rank, count, last_message, joined, tier, media_frozen FROM stats
+			WHERE chat_id = ? ORDER BY count DESC, user_id LIMIT ?`, chatID, limit)
+	}
+	return s.queryStats(`SELECT user_id, chat_id, 0, SUM(count) AS total, 0, 0, 0, 0 FROM daily_stats
+		WHERE chat_id = ? AND day >= ? GROUP BY user_id ORDER BY total DESC, user_id LIMIT ?`, chatID, statsDay(since), limit)
+}
+
+func (s *sqliteStore) PruneDailyStats(before time.Time) int {
+	result, err := s.db.Exec(`DELETE FROM daily_stats WHERE day < ?`, statsDay(before))
+	if err != nil {
+		slog.Warn("SQLite error:", "error", err)
+		return 0
+	}
+	counter, _ := result.RowsAffected()
+	return int(counter)
+}
+
+func (s *sqliteStore) GetUserID(username string) int64 {
+	var userID int64
+	err := s.db.QueryRow(`SELECT user_id FROM usernames WHERE username = ?`, username).Scan(&userID)
+	if err != nil && err != sql.ErrNoRows {
+		slog.Warn("SQLite error:", "error", err)
+	}
+	return userID
+}
+
+func (s *sqliteStore) SetUsername(username string, userID int64) {
+	s.exec(`INSERT OR REPLACE INTO usernames (username, user_id) VALUES (?, ?)`, username, userID)
+}
+
+func (s *sqliteStore) Jobs() []Job {
+	rows, err := s.db.Query(`SELECT id, kind, chat_id, user_id, message_id, text, due FROM jobs ORDER BY due`)
+	if err != nil {
+		slog.Warn("SQLite error:", "error", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		var job Job
+		var due int64
+		if err := rows.Scan(&job.ID, &job.Kind, &job.ChatID, &job.UserID, &job.MessageID, &job.Text, &due); err != nil {
+			slog.Warn("SQLite error:", "error", err)
+			continue
+		}
+		job.Due = time.Unix(due, 0).UTC()
+		jobs = append(jobs, job)
+	}
+	return jobs
+}
+
+func (s *sqliteStore) AddJob(job Job) Job {
+	result, err := s.db.Exec(`INSERT INTO jobs (kind, chat_id, user_id, message_id, text, due) VALUES (?, ?, ?, ?, ?, ?)`,
+		job.Kind, job.ChatID, job.UserID, job.MessageID, job.Text, job.Due.Unix())
+	if err != nil {
+		slog.Warn("SQLite error:", "error", err)
+		return job
+	}
+	job.ID, _ = result.LastInsertId()
+	return job
+}
+
+func (s *sqliteStore) RemoveJob(id int64) {
+	s.exec(`DELETE FROM jobs WHERE id = ?`, id)
+}
+
+func (s *sqliteStore) Warnings(userID int64, chatID int64, now time.Time) []Warning {
+	rows, err := s.db.Query(`SELECT chat_id, user_id, admin_id, reason, created, expires FROM warnings
+		WHERE chat_id = ? AND user_id = ? AND expires > ? ORDER BY created, id`, chatID, userID, now.Unix())
+	if err != nil {
+		slog.Warn("SQLite error:", "error", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var warnings []Warning
+	for rows.Next() {
+		var warning Warning
+		var created, expires int64
+		if err := rows.Scan(&warning.ChatID, &warning.UserID, &warning.AdminID, &warning.Reason, &created, &expires); err != nil {
+			slog.Warn("SQLite error:", "error", err)
+			continue
+		}
+		warning.Created = time.Unix(created, 0).UTC()
+		warning.Expires = time.Unix(expires, 0).UTC()
+		warnings = append(warnings, warning)
+	}
+	return warnings
+}
+
+func (s *sqliteStore) AddWarning(warning Warning) {
+	s.exec(`INSERT INTO warnings (chat_id, user_id, admin_id, reason, created, expires) VALUES (?, ?, ?, ?, ?, ?)`,
+		warning.ChatID, warning.UserID, warning.AdminID, warning.Reason, warning.Created.Unix(), warning.Expires.Unix())
+}
+
+func (s *sqliteStore) PruneWarnings(now time.Time) int {
+	result, err := s.db.Exec(`DELETE FROM warnings WHERE expires <= ?`, now.Unix())
+	if err != nil {
+		slog.Warn("SQLite error:", "error", err)
+		return 0
+	}
+	counter, _ := result.RowsAffected()
+	return int(counter)
+}
+
+func (s *sqliteStore) LastChanged() int64 {
+	var timestamp int64
+	err := s.db.QueryRow(`SELECT value FROM meta WHERE key = 'last_changed'`).Scan(&timestamp)
+	if err != nil && err != sql.ErrNoRows {
+		slog.Warn("SQLite error:", "error", err)
+	}
+	return timestamp
+}
+
+func (s *sqliteStore) SetLastChanged(timestamp int64) {
+	s.exec(`INSERT OR REPLACE INTO meta (key, value) VALUES ('last_changed', ?)`, timestamp)
+}
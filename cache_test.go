@@ -0,0 +1,365 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/OvyFlash/telegram-bot-api"
+)
+
+func testStores(t *testing.T) map[string]Store {
+	dir := t.TempDir()
+	jsonCache, err := newJsonStore(filepath.Join(dir, "cache.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqliteCache, err := newSQLiteStore(filepath.Join(dir, "cache.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqliteCache.Close() })
+	return map[string]Store{"json": jsonCache, "sqlite": sqliteCache}
+}
+
+// Update loop and sweeper run together, run with -race
+func Test_cacheUpdatesWithSweeper(t *testing.T) {
+	const users = 200
+	const chatID = -100
+
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			cache = store
+			done := make(chan struct{})
+
+			go func() {
+				defer close(done)
+				for user := int64(1); user <= users; user++ {
+					if !isCachedUser(user, chatID) {
+						t.Errorf("isCachedUser(%d) = false for new user", user)
+					}
+					welcomeSent(getChatConfig(chatID), tgbotapi.Message{MessageID: int(user), Chat: tgbotapi.Chat{ID: chatID}}, user, "", "")
+					cache.AddTrigger(WelcomeMessage{ID: int(user) + users, UserID: user, ChatID: chatID, Timestamp: time.Now().UTC().Add(TRIGGER_TTL)})
+					if isCachedUser(user, chatID) {
+						t.Errorf("isCachedUser(%d) = true for known user", user)
+					}
+				}
+			}()
+
+			// Everything is expired for the sweeper
+			deadline := time.Now().Add(time.Hour * 48)
+			welcomes, triggers := 0, 0
+			sweep := func() {
+				welcomes += len(cache.PopExpiredWelcomes(deadline))
+				triggers += len(cache.PopExpiredTriggers(deadline))
+				if err := cache.Save(); err != nil {
+					t.Error(err)
+				}
+			}
+		loop:
+			for {
+				select {
+				case <-done:
+					break loop
+				default:
+					sweep()
+				}
+			}
+			sweep()
+
+			if welcomes != users {
+				t.Errorf("popped welcomes = %d, want %d", welcomes, users)
+			}
+			if triggers != users {
+				t.Errorf("popped triggers = %d, want %d", triggers, users)
+			}
+			if got := len(cache.Members()); got != users {
+				t.Errorf("members = %d, want %d", got, users)
+			}
+		})
+	}
+}
+
+func Test_cacheAddMemberOnce(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			var wg sync.WaitGroup
+			var mu sync.Mutex
+			added := 0
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if store.AddMember(ChatMember{Id: 1, ChatId: -100}) {
+						mu.Lock()
+						added++
+						mu.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+
+			if added != 1 {
+				t.Errorf("AddMember() succeeded %d times, want 1", added)
+			}
+			store.AddMember(ChatMember{Id: 1, ChatId: -200})
+			store.RemoveMember(1, -100)
+			if store.GetMember(1, -100) != nil {
+				t.Errorf("GetMember() found removed member")
+			}
+			if store.GetMember(1, -200) == nil {
+				t.Errorf("GetMember() lost member of the other chat")
+			}
+		})
+	}
+}
+
+func Test_cacheVerdicts(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			want := BanVerdict{Provider: "lols", UserID: 1, Banned: true, Offenses: 2, Score: 0.5, Expires: now.Add(time.Hour)}
+			store.SetVerdict(want)
+			store.SetVerdict(BanVerdict{Provider: "cas", UserID: 1, Expires: now.Add(-time.Hour)})
+
+			if got := store.GetVerdict("lols", 1); got == nil || *got != want {
+				t.Errorf("GetVerdict() = %+v, want %+v", got, want)
+			}
+			if pruned := store.PruneVerdicts(now); pruned != 1 {
+				t.Errorf("PruneVerdicts() = %d, want 1", pruned)
+			}
+			if got := store.GetVerdict("cas", 1); got != nil {
+				t.Errorf("GetVerdict() = %+v for pruned verdict", got)
+			}
+		})
+	}
+}
+
+func Test_cacheWelcomeAnswer(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			want := WelcomeMessage{ID: 1, UserID: 2, ChatID: -100, Timestamp: time.Now().UTC().Truncate(time.Second), Answer: "12"}
+			store.AddWelcome(want)
+
+			if got := store.GetWelcome(-100, 1); got == nil || *got != want {
+				t.Errorf("GetWelcome() = %+v, want %+v", got, want)
+			}
+			if got := store.GetWelcome(-100, 2); got != nil {
+				t.Errorf("GetWelcome() = %+v for unknown message", got)
+			}
+			if got := store.GetUserWelcome(2, -100); got == nil || *got != want {
+				t.Errorf("GetUserWelcome() = %+v, want %+v", got, want)
+			}
+			if got := store.GetUserWelcome(2, -200); got != nil {
+				t.Errorf("GetUserWelcome() = %+v for other chat", got)
+			}
+		})
+	}
+}
+
+func Test_cacheBans(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			forever := LocalBan{UserID: 1, Reason: "spam", Source: "chat:-100", BannedBy: 10, Created: now}
+			expired := LocalBan{UserID: 2, Created: now.Add(-2 * time.Hour), Expires: now.Add(-time.Hour)}
+			store.AddBan(forever)
+			store.AddBan(expired)
+
+			if got := store.GetBan(1); got == nil || *got != forever {
+				t.Errorf("GetBan() = %+v, want %+v", got, forever)
+			}
+			if got := store.Bans(); len(got) != 2 || got[0] != expired {
+				t.Errorf("Bans() = %+v, want 2 bans oldest first", got)
+			}
+			if pruned := store.PruneBans(now); pruned != 1 {
+				t.Errorf("PruneBans() = %d, want 1", pruned)
+			}
+			if !store.RemoveBan(1) || store.RemoveBan(1) {
+				t.Errorf("RemoveBan() must succeed only once")
+			}
+			if got := store.Bans(); len(got) != 0 {
+				t.Errorf("Bans() = %+v, want empty", got)
+			}
+		})
+	}
+}
+
+func Test_cacheUsernames(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			store.SetUsername("newbie", 1)
+			store.SetUsername("newbie", 2)
+
+			if got := store.GetUserID("newbie"); got != 2 {
+				t.Errorf("GetUserID() = %d, want latest owner 2", got)
+			}
+			if got := store.GetUserID("nobody"); got != 0 {
+				t.Errorf("GetUserID() = %d for unknown username", got)
+			}
+		})
+	}
+}
+
+func Test_cacheStats(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			store.AddMessage(1, -100, now)
+			stats := store.AddMessage(1, -100, now.Add(time.Minute))
+			store.AddMessage(2, -100, now)
+			store.AddMessage(1, -200, now)
+
+			want := ChatMember{Id: 1, ChatId: -100, MessageCount: 2, LastMessage: now.Add(time.Minute)}
+			if stats != want {
+				t.Errorf("AddMessage() = %+v, want %+v", stats, want)
+			}
+			stats.Rank = 2
+			store.SetStats(stats)
+			if got := store.GetStats(1, -100); got == nil || *got != stats {
+				t.Errorf("GetStats() = %+v, want %+v", got, stats)
+			}
+			top := store.TopStats(-100, time.Time{}, 10)
+			if len(top) != 2 || top[0].Id != 1 || top[1].Id != 2 {
+				t.Errorf("TopStats() = %+v, want users 1 and 2 by count", top)
+			}
+
+			// Messages of two days ago are out of daily top
+			store.AddMessage(2, -100, now.AddDate(0, 0, -2))
+			store.AddMessage(2, -100, now.AddDate(0, 0, -2))
+			daily := store.TopStats(-100, now, 1)
+			if len(daily) != 1 || daily[0].Id != 1 || daily[0].MessageCount != 2 {
+				t.Errorf("TopStats() = %+v, want user 1 leading today", daily)
+			}
+			weekly := store.TopStats(-100, now.AddDate(0, 0, -6), 10)
+			if len(weekly) != 2 || weekly[0].Id != 2 || weekly[0].MessageCount != 3 {
+				t.Errorf("TopStats() = %+v, want user 2 leading the week", weekly)
+			}
+			if pruned := store.PruneDailyStats(now.AddDate(0, 0, -1)); pruned != 1 {
+				t.Errorf("PruneDailyStats() = %d, want 1", pruned)
+			}
+		})
+	}
+}
+
+func Test_cacheJobs(t *testing.T) {
+	due := time.Now().UTC().Truncate(time.Second)
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			first := store.AddJob(Job{Kind: JOB_DELETE_MESSAGE, ChatID: -100, MessageID: 5, Due: due})
+			second := store.AddJob(Job{Kind: JOB_REMINDER, ChatID: -100, UserID: 2, MessageID: 6, Text: "answer", Due: due.Add(time.Hour)})
+			if first.ID == 0 || first.ID == second.ID {
+				t.Fatalf("AddJob() ids = %d, %d, want unique", first.ID, second.ID)
+			}
+			if got := store.Jobs(); len(got) != 2 || got[0] != first || got[1] != second {
+				t.Errorf("Jobs() = %+v, want %+v and %+v", got, first, second)
+			}
+			store.RemoveJob(first.ID)
+			if got := store.Jobs(); len(got) != 1 || got[0] != second {
+				t.Errorf("Jobs() = %+v, want %+v", got, second)
+			}
+		})
+	}
+}
+
+func Test_cacheWarnings(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			old := Warning{ChatID: -100, UserID: 2, Reason: "flood", Created: now.Add(-2 * time.Hour), Expires: now.Add(-time.Hour)}
+			first := Warning{ChatID: -100, UserID: 2, AdminID: 10, Reason: "spam", Created: now.Add(-time.Minute), Expires: now.Add(time.Hour)}
+			second := Warning{ChatID: -100, UserID: 2, Reason: "flood", Created: now, Expires: now.Add(time.Hour)}
+			other := Warning{ChatID: -200, UserID: 2, Reason: "spam", Created: now, Expires: now.Add(time.Hour)}
+			for _, warning := range []Warning{old, first, second, other} {
+				store.AddWarning(warning)
+			}
+			if got := store.Warnings(2, -100, now); len(got) != 2 || got[0] != first || got[1] != second {
+				t.Errorf("Warnings() = %+v, want %+v and %+v", got, first, second)
+			}
+			if pruned := store.PruneWarnings(now); pruned != 1 {
+				t.Errorf("PruneWarnings() = %d, want 1", pruned)
+			}
+			if got := store.Warnings(2, -200, now); len(got) != 1 || got[0] != other {
+				t.Errorf("Warnings() = %+v, want %+v", got, other)
+			}
+		})
+	}
+}
+
+func Test_migrateJsonCache(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// cache.json is looked up in the working directory
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	old, err := newJsonStore(CACHE_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	member := ChatMember{Id: 1, ChatId: -100, WelcomeShowed: true}
+	welcome := WelcomeMessage{ID: 5, UserID: 1, ChatID: -100, Timestamp: now, Answer: "4", Challenge: "arithmetic"}
+	ban := LocalBan{UserID: 2, Reason: "spam", Source: "chat:-100", Created: now}
+	stats := ChatMember{Id: 3, ChatId: -100, MessageCount: 42, Rank: 1, LastMessage: now}
+	job := Job{Kind: JOB_DELETE_MESSAGE, ChatID: -100, MessageID: 5, Due: now.Add(time.Hour)}
+	warning := Warning{ChatID: -100, UserID: 3, Reason: "flood", Created: now, Expires: now.Add(time.Hour)}
+	old.AddMember(member)
+	old.AddWelcome(welcome)
+	old.AddBan(ban)
+	old.SetUsername("regular", 3)
+	old.SetStats(stats)
+	old.AddJob(job)
+	old.AddWarning(warning)
+	if err := old.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	MainConfig = Config{Storage: "sqlite", StoragePath: filepath.Join(dir, "cache.db")}
+	check := func(t *testing.T) {
+		store, err := openStore()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+
+		if got := store.Members(); len(got) != 1 || got[0] != member {
+			t.Errorf("Members() = %+v, want %+v", got, member)
+		}
+		if got := store.WelcomeQueue(); len(got) != 1 || got[0] != welcome {
+			t.Errorf("WelcomeQueue() = %+v, want %+v", got, welcome)
+		}
+		if got := store.Bans(); len(got) != 1 || got[0] != ban {
+			t.Errorf("Bans() = %+v, want %+v", got, ban)
+		}
+		if got := store.GetUserID("regular"); got != 3 {
+			t.Errorf("GetUserID() = %d, want 3", got)
+		}
+		if got := store.GetStats(3, -100); got == nil || *got != stats {
+			t.Errorf("GetStats() = %+v, want %+v", got, stats)
+		}
+		if got := store.Jobs(); len(got) != 1 || got[0].Kind != job.Kind || got[0].MessageID != job.MessageID || !got[0].Due.Equal(job.Due) {
+			t.Errorf("Jobs() = %+v, want %+v", got, job)
+		}
+		if got := store.Warnings(3, -100, now); len(got) != 1 || got[0] != warning {
+			t.Errorf("Warnings() = %+v, want %+v", got, warning)
+		}
+	}
+
+	check(t)
+	if _, err := os.Stat(CACHE_FILE); !os.IsNotExist(err) {
+		t.Errorf("%s is not renamed after migration", CACHE_FILE)
+	}
+	if _, err := os.Stat(CACHE_FILE + ".migrated"); err != nil {
+		t.Errorf("%s.migrated: %v", CACHE_FILE, err)
+	}
+	// Second start finds nothing to import, nothing is doubled
+	check(t)
+}
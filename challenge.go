@@ -0,0 +1,283 @@
+package main
+
+/*
+ - Challenge is a question for newcomers, selected per chat with `challenge:`.
+ - button(default): one "I am human" button.
+ - arithmetic: sum with answer buttons.
+ - emoji: find the named emoji among buttons.
+ - text: answer is typed in the chat, user can send text until then.
+ - `captcha_attempts` wrong answers are forgiven, then `captcha_action` is applied as on timeout.
+*/
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/OvyFlash/telegram-bot-api"
+)
+
+const DEFAULT_CHALLENGE = "button"
+
+// Actions for failed or ignored challenges
+const (
+	CAPTCHA_ACTION_KICK    = "kick"    //Can join again at once
+	CAPTCHA_ACTION_TEMPBAN = "tempban" //Banned for captcha_ban_duration
+	CAPTCHA_ACTION_BAN     = "ban"     //Banned and added to the local ban list
+	CAPTCHA_ACTION_MUTE    = "mute"    //Stays in the chat without rights
+)
+
+type Challenge interface {
+	Name() string
+	// Question returns welcome text, answer buttons(nil for typed answers) and the expected answer
+	Question(chat ChatConfig, user tgbotapi.User) (string, *tgbotapi.InlineKeyboardMarkup, string)
+	Check(answer string, response string) bool
+	// Typed answers come as chat messages
+	Typed() bool
+}
+
+var challenges = map[string]Challenge{
+	"button":     buttonChallenge{},
+	"arithmetic": arithmeticChallenge{},
+	"emoji":      emojiChallenge{},
+	"text":       textChallenge{},
+}
+
+func getChallenge(name string) Challenge {
+	if challenge, ok := challenges[name]; ok {
+		return challenge
+	}
+	return challenges[DEFAULT_CHALLENGE]
+}
+
+// getCaptchaChallenge is for suspicious users, any bot can click the button
+func getCaptchaChallenge(chat ChatConfig) Challenge {
+	if chat.Challenge == "" || chat.Challenge == "button" {
+		return challenges["arithmetic"]
+	}
+	return getChallenge(chat.Challenge)
+}
+
+func getCaptchaTimeout(chat ChatConfig) time.Duration {
+	if chat.CaptchaTimeout == 0 {
+		return DEFAULT_CAPTCHA_TIMEOUT
+	}
+	return chat.CaptchaTimeout
+}
+
+// readChallenges checks `challenge` and `captcha_action` of all chats
+func readChallenges() error {
+	for _, chat := range allChatConfigs() {
+		if _, ok := challenges[chat.Challenge]; chat.Challenge != "" && !ok {
+			return fmt.Errorf("chat %d: unknown challenge %q", chat.ID, chat.Challenge)
+		}
+		switch chat.CaptchaAction {
+		case "", CAPTCHA_ACTION_KICK, CAPTCHA_ACTION_TEMPBAN, CAPTCHA_ACTION_BAN, CAPTCHA_ACTION_MUTE:
+		default:
+			return fmt.Errorf("chat %d: unknown captcha_action %q", chat.ID, chat.CaptchaAction)
+		}
+	}
+	return nil
+}
+
+func captchaText(chat ChatConfig, user tgbotapi.User, question string) string {
+	template := chat.CaptchaMessage
+	if template == "" {
+		template = DEFAULT_CAPTCHA_MESSAGE
+	}
+	text := strings.Replace(template, "{namelink}", getNameLink(user), -1)
+	return strings.Replace(text, "{question}", question, -1)
+}
+
+func answerButton(user tgbotapi.User, text string, value string) tgbotapi.InlineKeyboardButton {
+	callbackData := "{\"command\": \"answer\", \"data\": \"" + strconv.FormatInt(user.ID, 10) + ":" + value + "\"}"
+	return tgbotapi.NewInlineKeyboardButtonData(text, callbackData)
+}
+
+// welcomeChatConfig is the profile of the chat the user joins, join request questions are in private chat
+func welcomeChatConfig(welcome WelcomeMessage) ChatConfig {
+	if welcome.JoinChat != 0 {
+		return getChatConfig(welcome.JoinChat)
+	}
+	return getChatConfig(welcome.ChatID)
+}
+
+// solveChallenge grants rights for the right answer, wrong answers over captcha_attempts fail the challenge.
+// Returns text for the user.
+func solveChallenge(welcome WelcomeMessage, response string) string {
+	if getChallenge(welcome.Challenge).Check(welcome.Answer, response) {
+		slog.Info(fmt.Sprintf("User %d solved %s challenge in chat %d", welcome.UserID, welcome.Challenge, welcome.ChatID))
+		deleteMessage(welcome.ChatID, welcome.ID)
+		if welcome.JoinChat != 0 {
+			return approveJoinRequest(welcome)
+		}
+		return grantUserRights(welcome.ChatID, welcome.UserID)
+	}
+	welcome.Attempts++
+	if left := welcomeChatConfig(welcome).CaptchaAttempts - welcome.Attempts + 1; left > 0 {
+		slog.Info(fmt.Sprintf("User %d answered wrong in chat %d, %d attempts left", welcome.UserID, welcome.ChatID, left))
+		cache.UpdateWelcome(welcome)
+		return fmt.Sprintf("Wrong answer, attempts left: %d", left)
+	}
+	slog.Info(fmt.Sprintf("User %d failed %s challenge in chat %d", welcome.UserID, welcome.Challenge, welcome.ChatID))
+	deleteMessage(welcome.ChatID, welcome.ID)
+	failChallenge(welcome, "captcha failed")
+	return "Wrong answer"
+}
+
+// failChallenge applies captcha_action of the chat, default is a temporary ban.
+// Join requests are declined, only ban action is applied to them.
+func failChallenge(welcome WelcomeMessage, reason string) {
+	if welcome.JoinChat != 0 {
+		declineJoinRequest(welcome.JoinChat, welcome.UserID, reason)
+		if welcomeChatConfig(welcome).CaptchaAction == CAPTCHA_ACTION_BAN {
+			banUser(welcome.JoinChat, welcome.UserID, 0, reason)
+		}
+		cache.RemoveWelcomeByUser(welcome.UserID, welcome.ChatID)
+		return
+	}
+	chat := getChatConfig(welcome.ChatID)
+	switch chat.CaptchaAction {
+	case CAPTCHA_ACTION_KICK:
+		kickUser(welcome.ChatID, welcome.UserID, 0, reason)
+	case CAPTCHA_ACTION_BAN:
+		banUser(welcome.ChatID, welcome.UserID, 0, reason)
+	case CAPTCHA_ACTION_MUTE:
+		// Initial rights are kept
+		slog.Info(fmt.Sprintf("User %d left muted in chat %d", welcome.UserID, welcome.ChatID))
+		logModeration(ModerationEntry{Action: "ro", ChatID: welcome.ChatID, UserID: welcome.UserID, Reason: reason})
+	default:
+		duration := chat.CaptchaBanDuration
+		if duration == 0 {
+			duration = DEFAULT_CAPTCHA_BAN_DURATION
+		}
+		until := time.Now().UTC().Add(duration)
+		BanChatMember(welcome.ChatID, welcome.UserID, until.Unix())
+		logModeration(ModerationEntry{Action: "tempban", ChatID: welcome.ChatID, UserID: welcome.UserID, Reason: reason, Until: until})
+	}
+	cache.RemoveMember(welcome.UserID, welcome.ChatID)
+	cache.RemoveWelcomeByUser(welcome.UserID, welcome.ChatID)
+}
+
+// checkTypedAnswer takes the message as the answer if user has a typed challenge,
+// join request challenges are answered in private chat.
+// Service messages, stickers and media are not answers.
+func checkTypedAnswer(message *tgbotapi.Message) bool {
+	if message.From == nil || message.NewChatMembers != nil || message.LeftChatMember != nil || message.Text == "" {
+		return false
+	}
+	welcome := cache.GetUserWelcome(message.From.ID, message.Chat.ID)
+	if welcome == nil || !getChallenge(welcome.Challenge).Typed() {
+		return false
+	}
+	deleteMessage(message.Chat.ID, message.MessageID)
+	slog.Info(solveChallenge(*welcome, message.Text))
+	return true
+}
+
+// hasPendingChallenge is true until the user answers the welcome question
+func hasPendingChallenge(chatID int64, userID int64) bool {
+	return cache.GetUserWelcome(userID, chatID) != nil
+}
+
+type buttonChallenge struct{}
+
+func (buttonChallenge) Name() string { return "button" }
+func (buttonChallenge) Typed() bool  { return false }
+
+func (buttonChallenge) Question(chat ChatConfig, user tgbotapi.User) (string, *tgbotapi.InlineKeyboardMarkup, string) {
+	text := strings.Replace(chat.WelcomeMessage, "{namelink}", getNameLink(user), -1)
+	// Old callback, welcome messages sent before challenges still work
+	callbackData := "{\"command\": \"upgrade_rights\", \"data\": \"" + strconv.FormatInt(user.ID, 10) + "\"}"
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(chat.WelcomeButtonMessage, callbackData),
+		),
+	)
+	return text, &keyboard, ""
+}
+
+func (buttonChallenge) Check(answer string, response string) bool {
+	return answer == response
+}
+
+type arithmeticChallenge struct{}
+
+func (arithmeticChallenge) Name() string { return "arithmetic" }
+func (arithmeticChallenge) Typed() bool  { return false }
+
+// Question asks a simple sum, answer buttons are shuffled
+func (arithmeticChallenge) Question(chat ChatConfig, user tgbotapi.User) (string, *tgbotapi.InlineKeyboardMarkup, string) {
+	a, b := rand.Intn(9)+1, rand.Intn(9)+1
+
+	// Answer and three different wrong options near it
+	options := []int{a + b}
+	for len(options) < 4 {
+		option := a + b + rand.Intn(11) - 5
+		if !slices.Contains(options, option) {
+			options = append(options, option)
+		}
+	}
+	rand.Shuffle(len(options), func(i, j int) { options[i], options[j] = options[j], options[i] })
+
+	var row []tgbotapi.InlineKeyboardButton
+	for _, option := range options {
+		value := strconv.Itoa(option)
+		row = append(row, answerButton(user, value, value))
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(row)
+	return captchaText(chat, user, fmt.Sprintf("%d + %d = ?", a, b)), &keyboard, strconv.Itoa(a + b)
+}
+
+func (arithmeticChallenge) Check(answer string, response string) bool {
+	return answer == response
+}
+
+type emojiChallenge struct{}
+
+var challengeEmoji = []struct {
+	Emoji string
+	Name  string
+}{
+	{"🐱", "cat"}, {"🐶", "dog"}, {"🍎", "apple"}, {"🚗", "car"},
+	{"🌵", "cactus"}, {"⚽", "ball"}, {"🎸", "guitar"}, {"🌙", "moon"},
+}
+
+func (emojiChallenge) Name() string { return "emoji" }
+func (emojiChallenge) Typed() bool  { return false }
+
+// Question names one of six emoji buttons
+func (emojiChallenge) Question(chat ChatConfig, user tgbotapi.User) (string, *tgbotapi.InlineKeyboardMarkup, string) {
+	options := rand.Perm(len(challengeEmoji))[:6]
+	answer := challengeEmoji[options[rand.Intn(len(options))]]
+
+	var row []tgbotapi.InlineKeyboardButton
+	for _, option := range options {
+		row = append(row, answerButton(user, challengeEmoji[option].Emoji, challengeEmoji[option].Emoji))
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(row[:3], row[3:])
+	return captchaText(chat, user, "press the "+answer.Name), &keyboard, answer.Emoji
+}
+
+func (emojiChallenge) Check(answer string, response string) bool {
+	return answer == response
+}
+
+type textChallenge struct{}
+
+func (textChallenge) Name() string { return "text" }
+func (textChallenge) Typed() bool  { return true }
+
+func (textChallenge) Question(chat ChatConfig, user tgbotapi.User) (string, *tgbotapi.InlineKeyboardMarkup, string) {
+	a, b := rand.Intn(9)+1, rand.Intn(9)+1
+	question := fmt.Sprintf("write the answer in the chat: %d + %d = ?", a, b)
+	return captchaText(chat, user, question), nil, strconv.Itoa(a + b)
+}
+
+func (textChallenge) Check(answer string, response string) bool {
+	return strings.EqualFold(strings.TrimSpace(response), answer)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/OvyFlash/telegram-bot-api"
+)
+
+func Test_challengeQuestion(t *testing.T) {
+	user := tgbotapi.User{ID: 42, FirstName: "Test"}
+	chat := ChatConfig{WelcomeMessage: "Hi {namelink}", WelcomeButtonMessage: "I am human"}
+	for name, challenge := range challenges {
+		t.Run(name, func(t *testing.T) {
+			text, keyboard, answer := challenge.Question(chat, user)
+			if !strings.Contains(text, "tg://user?id=42") {
+				t.Errorf("Question() text = %q, want name link", text)
+			}
+			if challenge.Typed() != (keyboard == nil) {
+				t.Fatalf("Question() keyboard = %v, typed %v", keyboard, challenge.Typed())
+			}
+			if !challenge.Check(answer, answer) {
+				t.Errorf("Check(%q, %q) = false", answer, answer)
+			}
+			if answer != "" && challenge.Check(answer, answer+"0") {
+				t.Errorf("Check(%q, %q) = true", answer, answer+"0")
+			}
+			if keyboard == nil || answer == "" {
+				return
+			}
+			found := false
+			for _, row := range keyboard.InlineKeyboard {
+				for _, button := range row {
+					found = found || strings.HasSuffix(*button.CallbackData, ":"+answer+"\"}")
+				}
+			}
+			if !found {
+				t.Errorf("Question() keyboard = %v, no button for answer %q", keyboard, answer)
+			}
+		})
+	}
+}
+
+func Test_getChallenge(t *testing.T) {
+	tests := []struct {
+		name    string
+		chat    string
+		want    string
+		captcha string
+	}{
+		{"Default", "", "button", "arithmetic"},
+		{"Button", "button", "button", "arithmetic"},
+		{"Emoji", "emoji", "emoji", "emoji"},
+		{"Text", "text", "text", "text"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chat := ChatConfig{Challenge: tt.chat}
+			if got := getChallenge(chat.Challenge).Name(); got != tt.want {
+				t.Errorf("getChallenge() = %s, want %s", got, tt.want)
+			}
+			if got := getCaptchaChallenge(chat).Name(); got != tt.captcha {
+				t.Errorf("getCaptchaChallenge() = %s, want %s", got, tt.captcha)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+/*
+ - Every managed chat has its own profile in `chats:` section of config.yaml.
+ - Top-level values act as defaults, chat profile overrides only the keys it sets.
+ - Chats without a profile use the defaults.
+ - Without `chats:` section the top-level config is the profile of `chat_id`.
+*/
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	tgbotapi "github.com/OvyFlash/telegram-bot-api"
+	"gopkg.in/yaml.v3"
+)
+
+const DEFAULT_TRIGGERS = "triggers.yaml"
+
+type ChatConfig struct {
+	ID                   int64             `yaml:"-"`
+	Title                string            `yaml:"title"`
+	WelcomeMessage       string            `yaml:"welcome_message"`
+	WelcomeButtonMessage string            `yaml:"welcome_button_message"`
+	ForbiddenText        []ForbiddenRule   `yaml:"forbiddenText"`
+	DenyBots             []string          `yaml:"denybots"`
+	DenyChats            []string          `yaml:"denychats"`
+	DenyNames            []string          `yaml:"denynames"`
+	AllowDomains         []string          `yaml:"allow_domains"`
+	DenyDomains          []string          `yaml:"deny_domains"`
+	NewcomerLinks        time.Duration     `yaml:"newcomer_links"` //Links of members joined less than this ago are deleted
+	DenyInvites          bool              `yaml:"deny_invites"`
+	DenyShorteners       bool              `yaml:"deny_shorteners"`
+	FloodMessages        int               `yaml:"flood_messages"` //More messages in flood_window is flood, 0 is off
+	FloodWindow          time.Duration     `yaml:"flood_window"`
+	FloodAction          string            `yaml:"flood_action"`       //delete, warn, mute or ban
+	FloodDuration        time.Duration     `yaml:"flood_duration"`     //For mute
+	DuplicateMessages    int               `yaml:"duplicate_messages"` //Copies of one text in duplicate_window, 0 is off
+	DuplicateWindow      time.Duration     `yaml:"duplicate_window"`
+	DuplicateMinLength   int               `yaml:"duplicate_min_length"` //Shorter texts are not compared
+	DuplicateAction      string            `yaml:"duplicate_action"`
+	DuplicateDuration    time.Duration     `yaml:"duplicate_duration"`
+	WarnExpire           time.Duration     `yaml:"warn_expire"`
+	WarnEscalation       []Sanction        `yaml:"warn_escalation"` //Sanction for each warning, the last repeats
+	LogChannel           int64             `yaml:"log_channel"`     //Moderation actions are posted here
+	Triggers             string            `yaml:"triggers"`
+	Admins               []int             `yaml:"admins"`
+	PinnedMessage        string            `yaml:"pinnedMessage"`
+	PinnedMessageId      int               `yaml:"pinnedMessageId"`
+	BanPolicy            BanPolicy         `yaml:"ban_policy"`
+	CaptchaMessage       string            `yaml:"captcha_message"` //{namelink} and {question} are replaced
+	Challenge            string            `yaml:"challenge"`       //button, arithmetic, emoji or text
+	CaptchaTimeout       time.Duration     `yaml:"captcha_timeout"`
+	CaptchaAttempts      int               `yaml:"captcha_attempts"`     //Wrong answers forgiven
+	CaptchaAction        string            `yaml:"captcha_action"`       //kick, tempban, ban or mute
+	CaptchaBanDuration   time.Duration     `yaml:"captcha_ban_duration"` //For tempban
+	DeleteJoinMessage    bool              `yaml:"delete_join_message"`
+	JoinRequests         bool              `yaml:"join_requests"`    //Screen join requests, the chat must require approval
+	CaptchaReminder      time.Duration     `yaml:"captcha_reminder"` //Reminder after this time, 0 is off
+	ReminderMessage      string            `yaml:"reminder_message"`
+	Ranks                map[string]string `yaml:"ranks"` //Messages count: title
+	RankMessage          string            `yaml:"rankMessage"`
+	RankMinLength        int               `yaml:"rank_min_length"` //Shorter messages are not counted
+	RankCooldown         time.Duration     `yaml:"rank_cooldown"`   //Messages sent faster are not counted
+	RightsTiers          []RightsTier      `yaml:"rights_tiers"`
+
+	denyNames []namePattern //Compiled DenyNames
+}
+
+// readChats builds chat profiles on top of the top-level defaults.
+func readChats(configFile []byte) error {
+	var raw struct {
+		Chats map[int64]yaml.Node `yaml:"chats"`
+	}
+	if err := yaml.Unmarshal(configFile, &raw); err != nil {
+		return err
+	}
+
+	if MainConfig.Triggers == "" {
+		MainConfig.Triggers = DEFAULT_TRIGGERS
+	}
+
+	MainConfig.Chats = make(map[int64]ChatConfig)
+	for id, node := range raw.Chats {
+		// Decode defaults first, so every profile gets its own copy of slices
+		var chat ChatConfig
+		if err := yaml.Unmarshal(configFile, &chat); err != nil {
+			return err
+		}
+		// Maps are merged on decode, chat ranks replace default ones
+		if hasKey(node, "ranks") {
+			chat.Ranks = nil
+		}
+		if err := node.Decode(&chat); err != nil {
+			return fmt.Errorf("chat %d: %w", id, err)
+		}
+		chat.ID = id
+		if chat.Triggers == "" {
+			chat.Triggers = DEFAULT_TRIGGERS
+		}
+		MainConfig.Chats[id] = chat
+	}
+	if len(MainConfig.Chats) == 0 {
+		if MainConfig.ChatID == 0 {
+			slog.Warn("No managed chats: neither chats nor chat_id are set in config.yaml, admins are not discovered and cached users are not kicked")
+		} else {
+			chat := MainConfig.ChatConfig
+			chat.ID = MainConfig.ChatID
+			MainConfig.Chats[chat.ID] = chat
+		}
+	}
+	slog.Info(fmt.Sprintf("Chats loaded: %d", len(MainConfig.Chats)))
+	return nil
+}
+
+func hasKey(node yaml.Node, key string) bool {
+	for id := 0; id+1 < len(node.Content); id += 2 {
+		if node.Content[id].Value == key {
+			return true
+		}
+	}
+	return false
+}
+
+func getChatConfig(chatID int64) ChatConfig {
+	if chat, ok := MainConfig.Chats[chatID]; ok {
+		return chat
+	}
+	chat := MainConfig.ChatConfig
+	chat.ID = chatID
+	return chat
+}
+
+// getUpdateChatConfig resolves the profile for the chat where update occurred.
+func getUpdateChatConfig(update tgbotapi.Update) ChatConfig {
+	if update.ChatMember != nil {
+		return getChatConfig(update.ChatMember.Chat.ID)
+	}
+	if update.ChatJoinRequest != nil {
+		return getChatConfig(update.ChatJoinRequest.Chat.ID)
+	}
+	if chat := update.FromChat(); chat != nil {
+		return getChatConfig(chat.ID)
+	}
+	return getChatConfig(0)
+}
+
+func isManagedChat(chatID int64) bool {
+	_, ok := MainConfig.Chats[chatID]
+	return ok
+}
+
+func managedChats() []int64 {
+	chats := make([]int64, 0, len(MainConfig.Chats))
+	for id := range MainConfig.Chats {
+		chats = append(chats, id)
+	}
+	sort.Slice(chats, func(i, j int) bool {
+		return chats[i] < chats[j]
+	})
+	return chats
+}
+
+// allChatConfigs returns the defaults, ID 0, and all chat profiles for config checks
+func allChatConfigs() []ChatConfig {
+	chats := []ChatConfig{MainConfig.ChatConfig}
+	for _, id := range managedChats() {
+		chats = append(chats, MainConfig.Chats[id])
+	}
+	return chats
+}
+
+// discoverAdmins adds chat administrators to the profile admins.
+func discoverAdmins() {
+	for _, id := range managedChats() {
+		admins, err := bot.GetChatAdministrators(tgbotapi.ChatAdministratorsConfig{ChatConfig: tgbotapi.ChatConfig{
+			ChatID: id,
+		}})
+		if err != nil {
+			slog.Warn(fmt.Sprintf("Can't get admins for chat %d", id), "error", err)
+			continue
+		}
+
+		chat := MainConfig.Chats[id]
+		for _, admin := range admins {
+			chat.Admins = append(chat.Admins, int(admin.User.ID))
+		}
+		chat.Admins = unique(chat.Admins)
+		MainConfig.Chats[id] = chat
+		slog.Info(fmt.Sprintf("Admins for chat %d: %v", id, chat.Admins))
+	}
+}
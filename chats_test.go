@@ -0,0 +1,112 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loadConfig parses the config the way readConfig does
+func loadConfig(t *testing.T, config string) {
+	t.Helper()
+	MainConfig = Config{}
+	if err := yaml.Unmarshal([]byte(config), &MainConfig); err != nil {
+		t.Fatal(err)
+	}
+	if err := readChats([]byte(config)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_readChats(t *testing.T) {
+	loadConfig(t, `
+welcome_message: "Hi"
+denynames: [casino]
+admins: [1]
+ranks:
+  "10": Newbie
+chats:
+  -1001:
+    welcome_message: "Привет"
+    admins: [2, 3]
+    ranks:
+      "50": Regular
+  -1002:
+    title: "Second"
+`)
+
+	if got := managedChats(); !reflect.DeepEqual(got, []int64{-1002, -1001}) {
+		t.Fatalf("managedChats() = %v", got)
+	}
+	var ids []int64
+	for _, chat := range allChatConfigs() {
+		ids = append(ids, chat.ID)
+	}
+	if !reflect.DeepEqual(ids, []int64{0, -1002, -1001}) {
+		t.Errorf("allChatConfigs() ids = %v, want defaults and profiles", ids)
+	}
+
+	first := getChatConfig(-1001)
+	if first.ID != -1001 || first.WelcomeMessage != "Привет" {
+		t.Errorf("chat -1001 = %d %q, want own welcome", first.ID, first.WelcomeMessage)
+	}
+	if !reflect.DeepEqual(first.Admins, []int{2, 3}) {
+		t.Errorf("chat -1001 admins = %v, want overridden", first.Admins)
+	}
+	if !reflect.DeepEqual(first.Ranks, map[string]string{"50": "Regular"}) {
+		t.Errorf("chat -1001 ranks = %v, want replaced, not merged", first.Ranks)
+	}
+	if !reflect.DeepEqual(first.DenyNames, []string{"casino"}) {
+		t.Errorf("chat -1001 denynames = %v, want inherited", first.DenyNames)
+	}
+	if first.Triggers != DEFAULT_TRIGGERS {
+		t.Errorf("chat -1001 triggers = %q, want default", first.Triggers)
+	}
+
+	second := getChatConfig(-1002)
+	if second.Title != "Second" || second.WelcomeMessage != "Hi" || !reflect.DeepEqual(second.Admins, []int{1}) {
+		t.Errorf("chat -1002 = %q %q %v, want defaults but title", second.Title, second.WelcomeMessage, second.Admins)
+	}
+	// Profiles don't share slices with each other
+	first.DenyNames[0] = "changed"
+	if second.DenyNames[0] != "casino" || MainConfig.DenyNames[0] != "casino" {
+		t.Errorf("denynames are shared between profiles")
+	}
+
+	if other := getChatConfig(-1003); isManagedChat(-1003) || other.ID != -1003 || other.WelcomeMessage != "Hi" {
+		t.Errorf("unmanaged chat = %+v, want defaults", other)
+	}
+}
+
+func Test_readChatsWithoutProfiles(t *testing.T) {
+	loadConfig(t, `
+welcome_message: "Hi"
+chat_id: -1001
+`)
+	if got := managedChats(); !reflect.DeepEqual(got, []int64{-1001}) {
+		t.Fatalf("managedChats() = %v, want chat_id", got)
+	}
+	if chat := getChatConfig(-1001); chat.ID != -1001 || chat.WelcomeMessage != "Hi" {
+		t.Errorf("chat = %d %q, want top-level config", chat.ID, chat.WelcomeMessage)
+	}
+
+	loadConfig(t, `welcome_message: "Hi"`)
+	if got := managedChats(); len(got) != 0 {
+		t.Errorf("managedChats() = %v, want none", got)
+	}
+}
+
+func Test_checkCachedQueueWithoutChats(t *testing.T) {
+	fake := setupTestBot(t)
+	MainConfig.Chats = map[int64]ChatConfig{}
+	fake.casBanned[testUser.ID] = true
+	cache.AddMember(ChatMember{Id: testUser.ID})
+
+	if counter := checkCachedQueue(); counter != 0 {
+		t.Errorf("checkCachedQueue() = %d, want 0", counter)
+	}
+	if members := cache.Members(); len(members) != 1 {
+		t.Errorf("members = %v, want legacy entry kept", members)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+/*
+ - Updates are processed by a pool of workers.
+ - Updates from one user in one chat always go to the same worker, so they keep their order.
+ - Worker queues are bounded, reading of new updates waits when a queue is full.
+*/
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"strconv"
+	"sync"
+
+	tgbotapi "github.com/OvyFlash/telegram-bot-api"
+)
+
+const DEFAULT_WORKERS = 4
+const DEFAULT_QUEUE_SIZE = 100
+
+func processUpdates(updates tgbotapi.UpdatesChannel) {
+	workers, queueSize := workerSettings()
+	slog.Info(fmt.Sprintf("Starting %d workers, queue size %d", workers, queueSize))
+	dispatchUpdates(updates, workers, queueSize, processUpdate)
+}
+
+// workerSettings returns configured workers and queue size or defaults
+func workerSettings() (int, int) {
+	workers := MainConfig.Workers
+	if workers <= 0 {
+		workers = DEFAULT_WORKERS
+	}
+	queueSize := MainConfig.QueueSize
+	if queueSize <= 0 {
+		queueSize = DEFAULT_QUEUE_SIZE
+	}
+	return workers, queueSize
+}
+
+// dispatchUpdates handles updates on workers until the channel is closed and queues are drained
+func dispatchUpdates(updates tgbotapi.UpdatesChannel, workers int, queueSize int, handle func(tgbotapi.Update)) {
+	var wg sync.WaitGroup
+	queues := make([]chan tgbotapi.Update, workers)
+	for id := range queues {
+		queues[id] = make(chan tgbotapi.Update, queueSize)
+		wg.Add(1)
+		go func(queue chan tgbotapi.Update) {
+			defer wg.Done()
+			for update := range queue {
+				handle(update)
+			}
+		}(queues[id])
+	}
+
+	for update := range updates {
+		requestsTotal.Inc()
+		queues[updateWorker(update, workers)] <- update
+	}
+
+	for _, queue := range queues {
+		close(queue)
+	}
+	wg.Wait()
+}
+
+// updateWorker picks worker by chat and user of the update
+func updateWorker(update tgbotapi.Update, workers int) int {
+	var chatID, userID int64
+	switch {
+	case update.ChatMember != nil:
+		chatID = update.ChatMember.Chat.ID
+		userID = update.ChatMember.NewChatMember.User.ID
+	case update.ChatJoinRequest != nil:
+		chatID = update.ChatJoinRequest.Chat.ID
+		userID = update.ChatJoinRequest.From.ID
+	case update.MyChatMember != nil:
+		chatID = update.MyChatMember.Chat.ID
+	default:
+		if chat := update.FromChat(); chat != nil {
+			chatID = chat.ID
+		}
+		if user := update.SentFrom(); user != nil {
+			userID = user.ID
+		}
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(strconv.FormatInt(chatID, 10) + ":" + strconv.FormatInt(userID, 10)))
+	return int(hash.Sum32() % uint32(workers))
+}
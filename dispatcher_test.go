@@ -0,0 +1,85 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/OvyFlash/telegram-bot-api"
+)
+
+func Test_workerSettings(t *testing.T) {
+	MainConfig = Config{}
+	if workers, queueSize := workerSettings(); workers != DEFAULT_WORKERS || queueSize != DEFAULT_QUEUE_SIZE {
+		t.Errorf("workerSettings() = %d, %d, want defaults", workers, queueSize)
+	}
+	MainConfig = Config{Workers: 2, QueueSize: 5}
+	if workers, queueSize := workerSettings(); workers != 2 || queueSize != 5 {
+		t.Errorf("workerSettings() = %d, %d, want 2, 5", workers, queueSize)
+	}
+}
+
+func Test_updateWorkerSameUser(t *testing.T) {
+	user := tgbotapi.User{ID: 500}
+	chat := tgbotapi.Chat{ID: testChatID, Type: "supergroup"}
+	message := &tgbotapi.Message{From: &user, Chat: chat}
+	updates := []tgbotapi.Update{
+		{Message: message},
+		{EditedMessage: message},
+		{CallbackQuery: &tgbotapi.CallbackQuery{From: &user, Message: message}},
+		{ChatMember: &tgbotapi.ChatMemberUpdated{Chat: chat, From: tgbotapi.User{ID: testAdminID}, NewChatMember: tgbotapi.ChatMember{User: &user}}},
+		{ChatJoinRequest: &tgbotapi.ChatJoinRequest{Chat: chat, From: user}},
+	}
+	for _, workers := range []int{1, 4, 16} {
+		want := updateWorker(updates[0], workers)
+		if want < 0 || want >= workers {
+			t.Fatalf("updateWorker() = %d of %d workers", want, workers)
+		}
+		for i, update := range updates[1:] {
+			if got := updateWorker(update, workers); got != want {
+				t.Errorf("update %d: worker %d, want %d of %d", i+1, got, want, workers)
+			}
+		}
+	}
+}
+
+func Test_dispatchUpdatesOrder(t *testing.T) {
+	const users = 20
+	const messages = 50
+	updates := make(chan tgbotapi.Update)
+	go func() {
+		defer close(updates)
+		for id := 1; id <= messages; id++ {
+			for user := int64(1); user <= users; user++ {
+				updates <- tgbotapi.Update{UpdateID: id, Message: &tgbotapi.Message{
+					MessageID: id,
+					From:      &tgbotapi.User{ID: user},
+					Chat:      tgbotapi.Chat{ID: testChatID},
+				}}
+			}
+		}
+	}()
+
+	var mu sync.Mutex
+	handled := map[int64][]int{}
+	dispatchUpdates(updates, 4, 2, func(update tgbotapi.Update) {
+		// Workers are not in step with each other
+		time.Sleep(time.Duration(rand.Intn(100)) * time.Microsecond)
+		mu.Lock()
+		defer mu.Unlock()
+		handled[update.Message.From.ID] = append(handled[update.Message.From.ID], update.Message.MessageID)
+	})
+
+	for user := int64(1); user <= users; user++ {
+		ids := handled[user]
+		if len(ids) != messages {
+			t.Fatalf("user %d: handled %d updates, want %d", user, len(ids), messages)
+		}
+		for i, id := range ids {
+			if id != i+1 {
+				t.Fatalf("user %d: updates handled in order %v", user, ids)
+			}
+		}
+	}
+}
@@ -0,0 +1,1234 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/OvyFlash/telegram-bot-api"
+)
+
+const testChatID = -1001
+const testAdminID = 10
+
+var testUser = tgbotapi.User{ID: 500, FirstName: "New", UserName: "newbie"}
+
+// setupTestBot points the bot to a fake Bot API server with one managed chat
+func setupTestBot(t *testing.T) *fakeBotAPI {
+	fake := newFakeBotAPI(t)
+
+	MainConfig = Config{ApiEndpoint: fake.endpoint(), ModerationLog: filepath.Join(t.TempDir(), "moderation.jsonl")}
+	MainConfig.ChatConfig = ChatConfig{
+		WelcomeMessage:       "Hi, {namelink}",
+		WelcomeButtonMessage: "I am human",
+		ForbiddenText:        []ForbiddenRule{{Text: "spam text"}},
+		Triggers:             DEFAULT_TRIGGERS,
+	}
+	chat := MainConfig.ChatConfig
+	chat.ID = testChatID
+	chat.Admins = []int{testAdminID}
+	MainConfig.Chats = map[int64]ChatConfig{testChatID: chat}
+	if err := readForbiddenText(); err != nil {
+		t.Fatal(err)
+	}
+
+	triggerSets = map[string]combotTrigger{
+		DEFAULT_TRIGGERS: {Trigger: []oldTrigger{{
+			Name:       "food",
+			Conditions: []oldCondition{{Value: "food"}},
+			Actions:    "Food guide",
+		}}},
+	}
+
+	store, err := newJsonStore(filepath.Join(t.TempDir(), "cache.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache = store
+	scheduler = newScheduler()
+	flood = newFloodDetector()
+
+	MainConfig.BanProviders = map[string]BanProviderConfig{
+		"cas":  {URL: fake.server.URL + "/cas/check?user_id="},
+		"lols": {URL: fake.server.URL + "/lols/account?id="},
+	}
+	if err := readBanProviders(); err != nil {
+		t.Fatal(err)
+	}
+
+	botInit()
+	fake.reset()
+	return fake
+}
+
+func joinUpdate(user tgbotapi.User) tgbotapi.Update {
+	return tgbotapi.Update{ChatMember: &tgbotapi.ChatMemberUpdated{
+		Chat:          tgbotapi.Chat{ID: testChatID, Type: "supergroup"},
+		From:          user,
+		Date:          int(time.Now().Unix()),
+		OldChatMember: tgbotapi.ChatMember{Status: "left", User: &user},
+		NewChatMember: tgbotapi.ChatMember{Status: "member", User: &user},
+	}}
+}
+
+func messageUpdate(user tgbotapi.User, text string) tgbotapi.Update {
+	return tgbotapi.Update{Message: &tgbotapi.Message{
+		MessageID: 77,
+		From:      &user,
+		Chat:      tgbotapi.Chat{ID: testChatID, Type: "supergroup"},
+		Date:      int(time.Now().Unix()),
+		Text:      text,
+	}}
+}
+
+func Test_joinAndClickButton(t *testing.T) {
+	fake := setupTestBot(t)
+
+	processUpdate(joinUpdate(testUser))
+
+	restricts := fake.methodCalls("restrictChatMember")
+	if len(restricts) != 1 || strings.Contains(restricts[0].Params.Get("permissions"), `"can_send_messages":true`) {
+		t.Fatalf("restrictChatMember calls = %v, want read-only rights", restricts)
+	}
+	welcomes := fake.methodCalls("sendMessage")
+	if len(welcomes) != 1 || !strings.Contains(welcomes[0].Params.Get("reply_markup"), "upgrade_rights") {
+		t.Fatalf("sendMessage calls = %v, want welcome with button", welcomes)
+	}
+	queue := cache.WelcomeQueue()
+	if len(queue) != 1 || queue[0].UserID != testUser.ID {
+		t.Fatalf("welcome queue = %v, want one message for user", queue)
+	}
+	fake.reset()
+
+	processUpdate(tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:      "1",
+		From:    &testUser,
+		Message: &tgbotapi.Message{MessageID: queue[0].ID, Chat: tgbotapi.Chat{ID: testChatID}},
+		Data:    `{"command": "upgrade_rights", "data": "` + strconv.FormatInt(testUser.ID, 10) + `"}`,
+	}})
+
+	restricts = fake.methodCalls("restrictChatMember")
+	if len(restricts) != 1 || !strings.Contains(restricts[0].Params.Get("permissions"), `"can_send_messages":true`) {
+		t.Errorf("restrictChatMember calls = %v, want upgraded rights", restricts)
+	}
+	answers := fake.methodCalls("answerCallbackQuery")
+	if len(answers) != 1 || answers[0].Params.Get("text") != "Rights upgraded!" {
+		t.Errorf("answerCallbackQuery calls = %v", answers)
+	}
+	deletes := fake.methodCalls("deleteMessage")
+	if len(deletes) != 1 || deletes[0].Params.Get("message_id") != strconv.Itoa(queue[0].ID) {
+		t.Errorf("deleteMessage calls = %v, want welcome deleted", deletes)
+	}
+	if queue := cache.WelcomeQueue(); len(queue) != 0 {
+		t.Errorf("welcome queue = %v, want empty", queue)
+	}
+}
+
+func Test_joinApiBanned(t *testing.T) {
+	fake := setupTestBot(t)
+	fake.casBanned[testUser.ID] = true
+
+	processUpdate(joinUpdate(testUser))
+
+	if bans := fake.methodCalls("banChatMember"); len(bans) != 1 {
+		t.Errorf("banChatMember calls = %v, want 1", bans)
+	}
+	if welcomes := fake.methodCalls("sendMessage"); len(welcomes) != 0 {
+		t.Errorf("sendMessage calls = %v, want no welcome", welcomes)
+	}
+}
+
+func Test_spamMessageDeleted(t *testing.T) {
+	fake := setupTestBot(t)
+
+	processUpdate(messageUpdate(testUser, "buy spam text now"))
+
+	deletes := fake.methodCalls("deleteMessage")
+	if len(deletes) != 1 || deletes[0].Params.Get("message_id") != "77" {
+		t.Errorf("deleteMessage calls = %v, want spam deleted", deletes)
+	}
+	if replies := fake.methodCalls("sendMessage"); len(replies) != 0 {
+		t.Errorf("sendMessage calls = %v, want none", replies)
+	}
+}
+
+func Test_adminMessageNotFiltered(t *testing.T) {
+	fake := setupTestBot(t)
+
+	processUpdate(messageUpdate(tgbotapi.User{ID: testAdminID}, "spam text example"))
+
+	if deletes := fake.methodCalls("deleteMessage"); len(deletes) != 0 {
+		t.Errorf("deleteMessage calls = %v, want none for admin", deletes)
+	}
+}
+
+func deleteJobs() []Job {
+	var jobs []Job
+	for _, job := range cache.Jobs() {
+		if job.Kind == JOB_DELETE_MESSAGE {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+func Test_triggerReply(t *testing.T) {
+	fake := setupTestBot(t)
+
+	processUpdate(messageUpdate(testUser, "food"))
+
+	replies := fake.methodCalls("sendMessage")
+	if len(replies) != 1 || replies[0].Params.Get("text") != "Food guide" {
+		t.Fatalf("sendMessage calls = %v, want trigger reply", replies)
+	}
+	if !strings.Contains(replies[0].Params.Get("reply_parameters"), `"message_id":77`) {
+		t.Errorf("reply_parameters = %s, want reply to trigger", replies[0].Params.Get("reply_parameters"))
+	}
+	// Both bot reply and user message are deleted later
+	if jobs := deleteJobs(); len(jobs) != 2 {
+		t.Errorf("delete jobs = %v, want 2 messages", jobs)
+	}
+}
+
+func Test_updatesLoop(t *testing.T) {
+	fake := setupTestBot(t)
+	fake.pushUpdate(tgbotapi.Update{UpdateID: 1, Message: messageUpdate(testUser, "food").Message})
+
+	done := make(chan struct{})
+	go func() {
+		processUpdates(startBot())
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(fake.methodCalls("sendMessage")) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	bot.StopReceivingUpdates()
+	<-done
+
+	if replies := fake.methodCalls("sendMessage"); len(replies) != 1 {
+		t.Errorf("sendMessage calls = %v, want trigger reply from polled update", replies)
+	}
+}
+
+// setBanPolicy enables captcha and media restriction for lols.bot spam_factor
+func setBanPolicy() {
+	chat := MainConfig.Chats[testChatID]
+	chat.BanPolicy = BanPolicy{SpamFactorWeight: 1, Captcha: 0.3, RestrictMedia: 0.6}
+	MainConfig.Chats[testChatID] = chat
+}
+
+func answerUpdate(messageID int, answer string) tgbotapi.Update {
+	return tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:      "2",
+		From:    &testUser,
+		Message: &tgbotapi.Message{MessageID: messageID, Chat: tgbotapi.Chat{ID: testChatID}},
+		Data:    `{"command": "answer", "data": "` + strconv.FormatInt(testUser.ID, 10) + `:` + answer + `"}`,
+	}}
+}
+
+func Test_joinCaptchaAnswer(t *testing.T) {
+	tests := []struct {
+		name       string
+		spamFactor float64
+		right      bool
+		wantMedia  bool
+	}{
+		{"RightAnswer", 0.4, true, true},
+		{"RightAnswerRestrictMedia", 0.7, true, false},
+		{"WrongAnswer", 0.4, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := setupTestBot(t)
+			setBanPolicy()
+			fake.spamFactor[testUser.ID] = tt.spamFactor
+
+			processUpdate(joinUpdate(testUser))
+
+			questions := fake.methodCalls("sendMessage")
+			if len(questions) != 1 || !strings.Contains(questions[0].Params.Get("reply_markup"), `\"answer\"`) {
+				t.Fatalf("sendMessage calls = %v, want question", questions)
+			}
+			queue := cache.WelcomeQueue()
+			if len(queue) != 1 || queue[0].Answer == "" {
+				t.Fatalf("welcome queue = %v, want one question with answer", queue)
+			}
+			answer := queue[0].Answer
+			if !tt.right {
+				answer += "0"
+			}
+			fake.reset()
+
+			processUpdate(answerUpdate(queue[0].ID, answer))
+
+			restricts := fake.methodCalls("restrictChatMember")
+			kicks := fake.methodCalls("banChatMember")
+			if !tt.right {
+				if len(restricts) != 0 || len(kicks) != 1 {
+					t.Errorf("restrictChatMember calls = %v, banChatMember calls = %v, want kick", restricts, kicks)
+				}
+			} else {
+				if len(restricts) != 1 || !strings.Contains(restricts[0].Params.Get("permissions"), `"can_send_messages":true`) {
+					t.Fatalf("restrictChatMember calls = %v, want upgraded rights", restricts)
+				}
+				if media := strings.Contains(restricts[0].Params.Get("permissions"), `"can_send_photos":true`); media != tt.wantMedia {
+					t.Errorf("permissions = %s, want media %v", restricts[0].Params.Get("permissions"), tt.wantMedia)
+				}
+			}
+			if queue := cache.WelcomeQueue(); len(queue) != 0 {
+				t.Errorf("welcome queue = %v, want empty", queue)
+			}
+		})
+	}
+}
+
+// commandUpdate is a command in private chat with the bot
+func commandUpdate(user tgbotapi.User, text string) tgbotapi.Update {
+	command := strings.SplitN(text, " ", 2)[0]
+	return tgbotapi.Update{Message: &tgbotapi.Message{
+		MessageID: 88,
+		From:      &user,
+		Chat:      tgbotapi.Chat{ID: user.ID, Type: "private"},
+		Date:      int(time.Now().Unix()),
+		Text:      text,
+		Entities:  []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(command)}},
+	}}
+}
+
+func Test_adminKickRemembered(t *testing.T) {
+	fake := setupTestBot(t)
+	admin := tgbotapi.User{ID: testAdminID}
+
+	kicked := joinUpdate(testUser)
+	kicked.ChatMember.From = admin
+	kicked.ChatMember.OldChatMember.Status = "member"
+	kicked.ChatMember.NewChatMember.Status = "kicked"
+	processUpdate(kicked)
+
+	ban := cache.GetBan(testUser.ID)
+	if ban == nil || ban.BannedBy != testAdminID || !ban.Expires.IsZero() {
+		t.Fatalf("GetBan() = %+v, want forever ban by admin", ban)
+	}
+
+	processUpdate(joinUpdate(testUser))
+	if bans := fake.methodCalls("banChatMember"); len(bans) != 1 {
+		t.Errorf("banChatMember calls = %v, want ban from local list", bans)
+	}
+}
+
+func Test_banListCommands(t *testing.T) {
+	fake := setupTestBot(t)
+	admin := tgbotapi.User{ID: testAdminID}
+
+	processUpdate(commandUpdate(testUser, "/banlist_add 700 spam"))
+	if cache.GetBan(700) != nil {
+		t.Fatalf("banlist_add accepted from non-admin")
+	}
+	// Ban list is shared by all chats, chat admins don't edit it
+	processUpdate(commandUpdate(admin, "/banlist_add 700 spam"))
+	if cache.GetBan(700) != nil {
+		t.Fatalf("banlist_add accepted from chat admin")
+	}
+	MainConfig.Admins = []int{testAdminID}
+	processUpdate(commandUpdate(admin, "/banlist_add 700 spam"))
+	if ban := cache.GetBan(700); ban == nil || ban.Reason != "spam" || ban.BannedBy != testAdminID {
+		t.Fatalf("GetBan() = %+v, want ban added by admin", ban)
+	}
+
+	processUpdate(commandUpdate(admin, "/banlist_export csv"))
+	if documents := fake.methodCalls("sendDocument"); len(documents) != 1 {
+		t.Errorf("sendDocument calls = %v, want exported list", documents)
+	}
+
+	fake.files["list"] = []byte(`[{"user_id": 701, "reason": "ads"}]`)
+	importCommand := commandUpdate(admin, "/banlist_import")
+	importCommand.Message.ReplyToMessage = &tgbotapi.Message{Document: &tgbotapi.Document{FileID: "list", FileName: "friends.json"}}
+	processUpdate(importCommand)
+	if ban := cache.GetBan(701); ban == nil || ban.Source != "friends.json" {
+		t.Errorf("GetBan() = %+v, want imported ban", ban)
+	}
+
+	processUpdate(commandUpdate(admin, "/banlist_remove 700"))
+	if cache.GetBan(700) != nil {
+		t.Errorf("banlist_remove kept the ban")
+	}
+}
+
+func Test_unbanCommand(t *testing.T) {
+	admin := tgbotapi.User{ID: testAdminID}
+	forwarded := commandUpdate(admin, "/unban")
+	forwarded.Message.ReplyToMessage = &tgbotapi.Message{ForwardOrigin: &tgbotapi.MessageOrigin{Type: "user", SenderUser: &testUser}}
+	tests := []struct {
+		name   string
+		update tgbotapi.Update
+	}{
+		{"ByID", commandUpdate(admin, "/unban "+strconv.FormatInt(testUser.ID, 10))},
+		{"ByUsername", commandUpdate(admin, "/unban @NewBie")},
+		{"ByForward", forwarded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := setupTestBot(t)
+			MainConfig.Admins = []int{testAdminID}
+			// Username is learned from seen updates
+			processUpdate(joinUpdate(testUser))
+			cache.AddBan(LocalBan{UserID: testUser.ID, Created: time.Now()})
+			fake.reset()
+
+			processUpdate(tt.update)
+
+			unbans := fake.methodCalls("unbanChatMember")
+			if len(unbans) != 1 || unbans[0].Params.Get("only_if_banned") != "true" || unbans[0].Params.Get("user_id") != "500" {
+				t.Errorf("unbanChatMember calls = %v, want unban in managed chat", unbans)
+			}
+			if cache.GetBan(testUser.ID) != nil {
+				t.Errorf("user is still in ban list")
+			}
+			if queue := cache.WelcomeQueue(); len(queue) != 0 {
+				t.Errorf("welcome queue = %v, want empty", queue)
+			}
+			if deletes := fake.methodCalls("deleteMessage"); len(deletes) != 1 {
+				t.Errorf("deleteMessage calls = %v, want welcome deleted", deletes)
+			}
+			replies := fake.methodCalls("sendMessage")
+			if len(replies) != 1 || !strings.Contains(replies[0].Params.Get("text"), "unbanned in 1 of 1 chats") {
+				t.Errorf("sendMessage calls = %v, want unban result", replies)
+			}
+			log, err := os.ReadFile(MainConfig.ModerationLog)
+			if err != nil || !strings.Contains(string(log), `"action":"unban","chat_id":-1001,"user_id":500,"admin_id":10`) {
+				t.Errorf("moderation log = %s, %v, want unban entry", log, err)
+			}
+		})
+	}
+}
+
+func Test_unbanByChatAdmin(t *testing.T) {
+	fake := setupTestBot(t)
+	other := getChatConfig(testChatID)
+	other.ID = -1002
+	other.Admins = []int{11}
+	MainConfig.Chats[other.ID] = other
+	processUpdate(joinUpdate(testUser))
+	otherJoin := joinUpdate(testUser)
+	otherJoin.ChatMember.Chat.ID = other.ID
+	processUpdate(otherJoin)
+	cache.AddBan(LocalBan{UserID: testUser.ID, Created: time.Now()})
+	fake.reset()
+
+	processUpdate(commandUpdate(tgbotapi.User{ID: testAdminID}, "/unban 500"))
+
+	unbans := fake.methodCalls("unbanChatMember")
+	if len(unbans) != 1 || unbans[0].Params.Get("chat_id") != "-1001" {
+		t.Errorf("unbanChatMember calls = %v, want unban only in own chat", unbans)
+	}
+	if cache.GetBan(testUser.ID) == nil {
+		t.Errorf("chat admin removed the ban list entry")
+	}
+	if queue := cache.WelcomeQueue(); len(queue) != 1 || queue[0].ChatID != other.ID {
+		t.Errorf("welcome queue = %v, want welcome in other chat kept", queue)
+	}
+	replies := fake.methodCalls("sendMessage")
+	if len(replies) != 1 || !strings.Contains(replies[0].Params.Get("text"), "unbanned in 1 of 1 chats, ban list entry is kept") {
+		t.Errorf("sendMessage calls = %v, want unban result", replies)
+	}
+}
+
+func Test_unbanUnknownUsername(t *testing.T) {
+	fake := setupTestBot(t)
+
+	processUpdate(commandUpdate(tgbotapi.User{ID: testAdminID}, "/unban @nobody"))
+
+	if unbans := fake.methodCalls("unbanChatMember"); len(unbans) != 0 {
+		t.Errorf("unbanChatMember calls = %v, want none", unbans)
+	}
+	replies := fake.methodCalls("sendMessage")
+	if len(replies) != 1 || !strings.Contains(replies[0].Params.Get("text"), "was not seen") {
+		t.Errorf("sendMessage calls = %v, want error reply", replies)
+	}
+}
+
+func Test_rankUp(t *testing.T) {
+	fake := setupTestBot(t)
+	chat := MainConfig.Chats[testChatID]
+	chat.Ranks = map[string]string{"0": "Newbie", "2": "Guest"}
+	chat.RankMessage = "{name} got level {newlvl}: {newrank}"
+	chat.RankCooldown = time.Minute
+	MainConfig.Chats[testChatID] = chat
+
+	start := time.Now().Add(-time.Hour)
+	send := func(text string, sent time.Time) {
+		update := messageUpdate(testUser, text)
+		update.Message.Date = int(sent.Unix())
+		processUpdate(update)
+	}
+	send("hello everyone", start)
+	send("within cooldown", start.Add(time.Second))
+	send("ok", start.Add(2*time.Minute))
+	send("buy spam text now", start.Add(4*time.Minute))
+	if stats := cache.GetStats(testUser.ID, testChatID); stats == nil || stats.MessageCount != 1 || stats.Rank != 1 {
+		t.Fatalf("GetStats() = %+v, want 1 counted message with rank 1", stats)
+	}
+	if replies := fake.methodCalls("sendMessage"); len(replies) != 0 {
+		t.Fatalf("sendMessage calls = %v, want no announcement for the first rank", replies)
+	}
+
+	send("second message", start.Add(6*time.Minute))
+	replies := fake.methodCalls("sendMessage")
+	if len(replies) != 1 || !strings.HasSuffix(replies[0].Params.Get("text"), "got level 2: Guest") {
+		t.Fatalf("sendMessage calls = %v, want rank announcement", replies)
+	}
+	if stats := cache.GetStats(testUser.ID, testChatID); stats.Rank != 2 {
+		t.Errorf("rank = %d, want 2", stats.Rank)
+	}
+}
+
+func Test_rankAndTopCommands(t *testing.T) {
+	fake := setupTestBot(t)
+	chat := MainConfig.Chats[testChatID]
+	chat.Ranks = map[string]string{"0": "Newbie", "10": "Guest"}
+	MainConfig.Chats[testChatID] = chat
+	fake.members[testUser.ID] = tgbotapi.ChatMember{Status: "member", User: &testUser}
+	cache.AddMessage(testUser.ID, testChatID, time.Now().AddDate(0, 0, -3))
+	cache.AddMessage(testUser.ID, testChatID, time.Now())
+	cache.AddMessage(testAdminID, testChatID, time.Now().AddDate(0, 0, -3))
+
+	group := func(text string) tgbotapi.Update {
+		update := commandUpdate(testUser, text)
+		update.Message.Chat = tgbotapi.Chat{ID: testChatID, Type: "supergroup"}
+		return update
+	}
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"/rank", "<b>New</b>: 2 messages, level 1 «Newbie»\r\n8 more to level 2 «Guest»"},
+		{"/top", "<b>Top of all time</b>\r\n1. New — 2\r\n2. 10 — 1"},
+		{"/top day", "<b>Top of the day</b>\r\n1. New — 1"},
+		{"/top week", "<b>Top of the week</b>\r\n1. New — 2\r\n2. 10 — 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			fake.reset()
+			processUpdate(group(tt.command))
+
+			replies := fake.methodCalls("sendMessage")
+			if len(replies) != 1 || replies[0].Params.Get("text") != tt.want {
+				t.Fatalf("sendMessage calls = %v, want %q", replies, tt.want)
+			}
+			if deletes := fake.methodCalls("deleteMessage"); len(deletes) != 0 {
+				t.Errorf("deleteMessage calls = %v, want delayed deletion", deletes)
+			}
+		})
+	}
+	// Command and reply of every run are deleted later
+	if jobs := deleteJobs(); len(jobs) != 2*len(tests) {
+		t.Errorf("delete jobs = %d messages, want %d", len(jobs), 2*len(tests))
+	}
+}
+
+func Test_rightsTiers(t *testing.T) {
+	fake := setupTestBot(t)
+	chat := MainConfig.Chats[testChatID]
+	chat.RightsTiers = []RightsTier{
+		{Rights: []string{"messages"}},
+		{Messages: 2, Rights: []string{"messages", "media"}},
+	}
+	chat.RankCooldown = time.Nanosecond
+	MainConfig.Chats[testChatID] = chat
+
+	processUpdate(joinUpdate(testUser))
+	welcome := cache.WelcomeQueue()[0]
+	fake.reset()
+	processUpdate(tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:      "1",
+		From:    &testUser,
+		Message: &tgbotapi.Message{MessageID: welcome.ID, Chat: tgbotapi.Chat{ID: testChatID}},
+		Data:    `{"command": "upgrade_rights", "data": "` + strconv.FormatInt(testUser.ID, 10) + `"}`,
+	}})
+	restricts := fake.methodCalls("restrictChatMember")
+	if len(restricts) != 1 || strings.Contains(restricts[0].Params.Get("permissions"), `"can_send_photos":true`) {
+		t.Fatalf("restrictChatMember calls = %v, want base tier without media", restricts)
+	}
+
+	for i := 0; i < 3; i++ {
+		update := messageUpdate(testUser, "message number "+strconv.Itoa(i))
+		update.Message.Date += i
+		processUpdate(update)
+	}
+	restricts = fake.methodCalls("restrictChatMember")
+	if len(restricts) != 2 || !strings.Contains(restricts[1].Params.Get("permissions"), `"can_send_photos":true`) {
+		t.Errorf("restrictChatMember calls = %v, want media after 2 messages once", restricts)
+	}
+}
+
+func Test_rightsTiersRestrictMedia(t *testing.T) {
+	fake := setupTestBot(t)
+	setBanPolicy()
+	fake.spamFactor[testUser.ID] = 0.7
+	chat := MainConfig.Chats[testChatID]
+	chat.RightsTiers = []RightsTier{
+		{Rights: []string{"messages"}},
+		{Messages: 1, Rights: []string{"messages", "media"}},
+	}
+	chat.RankCooldown = time.Nanosecond
+	MainConfig.Chats[testChatID] = chat
+
+	processUpdate(joinUpdate(testUser))
+	welcome := cache.WelcomeQueue()[0]
+	processUpdate(answerUpdate(welcome.ID, welcome.Answer))
+	fake.reset()
+
+	for i := 0; i < 2; i++ {
+		update := messageUpdate(testUser, "message number "+strconv.Itoa(i))
+		update.Message.Date += i
+		processUpdate(update)
+	}
+	if restricts := fake.methodCalls("restrictChatMember"); len(restricts) != 0 {
+		t.Fatalf("restrictChatMember calls = %v, want tiers not applied", restricts)
+	}
+
+	liftRestriction(testChatID, testUser.ID)
+	restricts := fake.methodCalls("restrictChatMember")
+	if len(restricts) != 1 || strings.Contains(restricts[0].Params.Get("permissions"), `"can_send_photos":true`) ||
+		!strings.Contains(restricts[0].Params.Get("permissions"), `"can_send_messages":true`) {
+		t.Errorf("restrictChatMember calls = %v, want text-only rights back", restricts)
+	}
+}
+
+func setChallenge(name string) {
+	chat := MainConfig.Chats[testChatID]
+	chat.Challenge = name
+	MainConfig.Chats[testChatID] = chat
+}
+
+func Test_joinChallenges(t *testing.T) {
+	tests := []struct {
+		name      string
+		challenge string
+		right     bool
+	}{
+		{"EmojiRight", "emoji", true},
+		{"EmojiWrong", "emoji", false},
+		{"TextRight", "text", true},
+		{"TextWrong", "text", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := setupTestBot(t)
+			setChallenge(tt.challenge)
+
+			processUpdate(joinUpdate(testUser))
+
+			queue := cache.WelcomeQueue()
+			if len(queue) != 1 || queue[0].Challenge != tt.challenge || queue[0].Answer == "" {
+				t.Fatalf("welcome queue = %v, want one %s challenge", queue, tt.challenge)
+			}
+			answer := queue[0].Answer
+			if !tt.right {
+				answer = "wrong"
+			}
+			typed := tt.challenge == "text"
+			if restricts := fake.methodCalls("restrictChatMember"); typed && len(restricts) != 2 {
+				t.Fatalf("restrictChatMember calls = %v, want text rights for the answer", restricts)
+			}
+			fake.reset()
+
+			if typed {
+				processUpdate(messageUpdate(testUser, " "+answer+" "))
+			} else {
+				processUpdate(answerUpdate(queue[0].ID, answer))
+			}
+
+			restricts := fake.methodCalls("restrictChatMember")
+			kicks := fake.methodCalls("banChatMember")
+			if tt.right && (len(restricts) != 1 || len(kicks) != 0) {
+				t.Errorf("restrictChatMember calls = %v, banChatMember calls = %v, want upgraded rights", restricts, kicks)
+			}
+			if !tt.right && (len(restricts) != 0 || len(kicks) != 1) {
+				t.Errorf("restrictChatMember calls = %v, banChatMember calls = %v, want kick", restricts, kicks)
+			}
+			if typed && len(fake.methodCalls("deleteMessage")) != 2 {
+				t.Errorf("deleteMessage calls = %v, want question and answer deleted", fake.methodCalls("deleteMessage"))
+			}
+			if queue := cache.WelcomeQueue(); len(queue) != 0 {
+				t.Errorf("welcome queue = %v, want empty", queue)
+			}
+		})
+	}
+}
+
+func Test_typedAnswerAfterJoinMessage(t *testing.T) {
+	fake := setupTestBot(t)
+	setChallenge("text")
+
+	processUpdate(joinUpdate(testUser))
+	queue := cache.WelcomeQueue()
+	if len(queue) != 1 {
+		t.Fatalf("welcome queue = %v, want one question", queue)
+	}
+	fake.reset()
+
+	// Join service message and a sticker come before the answer
+	join := messageUpdate(testUser, "")
+	join.Message.NewChatMembers = []tgbotapi.User{testUser}
+	processUpdate(join)
+	sticker := messageUpdate(testUser, "")
+	sticker.Message.Sticker = &tgbotapi.Sticker{FileID: "sticker"}
+	processUpdate(sticker)
+	if kicks := fake.methodCalls("banChatMember"); len(kicks) != 0 {
+		t.Fatalf("banChatMember calls = %v, want no answer taken", kicks)
+	}
+	if queue := cache.WelcomeQueue(); len(queue) != 1 || queue[0].Attempts != 0 {
+		t.Fatalf("welcome queue = %v, want the question without attempts", queue)
+	}
+
+	processUpdate(messageUpdate(testUser, queue[0].Answer))
+	if kicks := fake.methodCalls("banChatMember"); len(kicks) != 0 {
+		t.Errorf("banChatMember calls = %v, want none", kicks)
+	}
+	if restricts := fake.methodCalls("restrictChatMember"); len(restricts) != 1 {
+		t.Errorf("restrictChatMember calls = %v, want upgraded rights", restricts)
+	}
+	if queue := cache.WelcomeQueue(); len(queue) != 0 {
+		t.Errorf("welcome queue = %v, want empty", queue)
+	}
+}
+
+func Test_captchaAttempts(t *testing.T) {
+	fake := setupTestBot(t)
+	chat := MainConfig.Chats[testChatID]
+	chat.Challenge = "arithmetic"
+	chat.CaptchaAttempts = 1
+	MainConfig.Chats[testChatID] = chat
+
+	processUpdate(joinUpdate(testUser))
+	queue := cache.WelcomeQueue()
+	if len(queue) != 1 {
+		t.Fatalf("welcome queue = %v, want one question", queue)
+	}
+	fake.reset()
+
+	processUpdate(answerUpdate(queue[0].ID, queue[0].Answer+"0"))
+	if kicks := fake.methodCalls("banChatMember"); len(kicks) != 0 {
+		t.Fatalf("banChatMember calls = %v, want first wrong answer forgiven", kicks)
+	}
+	if queue := cache.WelcomeQueue(); len(queue) != 1 || queue[0].Attempts != 1 {
+		t.Fatalf("welcome queue = %v, want one attempt", queue)
+	}
+
+	processUpdate(answerUpdate(queue[0].ID, queue[0].Answer+"0"))
+	if kicks := fake.methodCalls("banChatMember"); len(kicks) != 1 {
+		t.Errorf("banChatMember calls = %v, want ban after the second wrong answer", kicks)
+	}
+	if queue := cache.WelcomeQueue(); len(queue) != 0 {
+		t.Errorf("welcome queue = %v, want empty", queue)
+	}
+}
+
+func Test_captchaTimeoutAction(t *testing.T) {
+	tests := []struct {
+		action     string
+		wantBans   int
+		wantUnbans int
+		wantLocal  bool
+	}{
+		{"", 1, 0, false},
+		{CAPTCHA_ACTION_KICK, 1, 1, false},
+		{CAPTCHA_ACTION_BAN, 1, 0, true},
+		{CAPTCHA_ACTION_MUTE, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run("Action"+tt.action, func(t *testing.T) {
+			fake := setupTestBot(t)
+			chat := MainConfig.Chats[testChatID]
+			chat.CaptchaAction = tt.action
+			chat.CaptchaTimeout = time.Minute
+			MainConfig.Chats[testChatID] = chat
+
+			processUpdate(joinUpdate(testUser))
+			queue := cache.WelcomeQueue()
+			if len(queue) != 1 || time.Until(queue[0].Timestamp) > time.Minute {
+				t.Fatalf("welcome queue = %v, want one welcome expiring in a minute", queue)
+			}
+			fake.reset()
+
+			if counter := CleanUpWelcome(); counter != 0 {
+				t.Fatalf("CleanUpWelcome() = %d before timeout", counter)
+			}
+			queue[0].Timestamp = time.Now().UTC().Add(-time.Second)
+			cache.UpdateWelcome(queue[0])
+			if counter := CleanUpWelcome(); counter != 1 {
+				t.Fatalf("CleanUpWelcome() = %d, want 1", counter)
+			}
+
+			if bans := fake.methodCalls("banChatMember"); len(bans) != tt.wantBans {
+				t.Errorf("banChatMember calls = %v, want %d", bans, tt.wantBans)
+			}
+			if unbans := fake.methodCalls("unbanChatMember"); len(unbans) != tt.wantUnbans {
+				t.Errorf("unbanChatMember calls = %v, want %d", unbans, tt.wantUnbans)
+			}
+			if local := cache.GetBan(testUser.ID) != nil; local != tt.wantLocal {
+				t.Errorf("local ban = %v, want %v", local, tt.wantLocal)
+			}
+		})
+	}
+}
+
+func Test_deleteJoinMessage(t *testing.T) {
+	fake := setupTestBot(t)
+	chat := MainConfig.Chats[testChatID]
+	chat.DeleteJoinMessage = true
+	MainConfig.Chats[testChatID] = chat
+
+	update := messageUpdate(testUser, "")
+	update.Message.NewChatMembers = []tgbotapi.User{testUser}
+	processUpdate(update)
+
+	deletes := fake.methodCalls("deleteMessage")
+	if len(deletes) != 1 || deletes[0].Params.Get("message_id") != "77" {
+		t.Errorf("deleteMessage calls = %v, want join message deleted", deletes)
+	}
+}
+
+func Test_schedulerChallengeTimeout(t *testing.T) {
+	fake := setupTestBot(t)
+	chat := MainConfig.Chats[testChatID]
+	chat.CaptchaTimeout = time.Hour
+	chat.CaptchaReminder = 30 * time.Minute
+	MainConfig.Chats[testChatID] = chat
+
+	processUpdate(joinUpdate(testUser))
+	if jobs := cache.Jobs(); len(jobs) != 2 {
+		t.Fatalf("jobs = %+v, want timeout and reminder", jobs)
+	}
+	fake.reset()
+
+	// Restart keeps jobs
+	scheduler = newScheduler()
+	migrateQueues()
+	scheduler.load()
+	if jobs := cache.Jobs(); len(jobs) != 2 {
+		t.Fatalf("jobs after restart = %+v, want no duplicates", jobs)
+	}
+
+	now := time.Now().UTC()
+	if counter := scheduler.runDue(now); counter != 0 {
+		t.Fatalf("runDue() = %d before deadlines", counter)
+	}
+	scheduler.runDue(now.Add(31 * time.Minute))
+	reminders := fake.methodCalls("sendMessage")
+	if len(reminders) != 1 || !strings.Contains(reminders[0].Params.Get("text"), "please answer") {
+		t.Fatalf("sendMessage calls = %v, want reminder", reminders)
+	}
+
+	scheduler.runDue(now.Add(61 * time.Minute))
+	if kicks := fake.methodCalls("banChatMember"); len(kicks) != 1 {
+		t.Errorf("banChatMember calls = %v, want timeout kick", kicks)
+	}
+	if deletes := fake.methodCalls("deleteMessage"); len(deletes) != 2 {
+		t.Errorf("deleteMessage calls = %v, want welcome and reminder deleted", deletes)
+	}
+	if jobs := cache.Jobs(); len(jobs) != 0 {
+		t.Errorf("jobs = %+v, want empty", jobs)
+	}
+}
+
+// Answer in one chat doesn't touch the challenge of the user in another chat
+func Test_challengesInTwoChats(t *testing.T) {
+	fake := setupTestBot(t)
+	const otherChatID = -1002
+	other := MainConfig.Chats[testChatID]
+	other.ID = otherChatID
+	MainConfig.Chats[otherChatID] = other
+
+	processUpdate(joinUpdate(testUser))
+	join := joinUpdate(testUser)
+	join.ChatMember.Chat.ID = otherChatID
+	processUpdate(join)
+	queue := cache.WelcomeQueue()
+	if len(queue) != 2 || queue[0].ChatID != testChatID {
+		t.Fatalf("welcome queue = %v, want welcomes in both chats", queue)
+	}
+	fake.reset()
+
+	update := answerUpdate(queue[0].ID, "")
+	update.CallbackQuery.Data = `{"command": "upgrade_rights", "data": "` + strconv.FormatInt(testUser.ID, 10) + `"}`
+	processUpdate(update)
+	if restricts := fake.methodCalls("restrictChatMember"); len(restricts) != 1 || restricts[0].Params.Get("chat_id") != strconv.Itoa(testChatID) {
+		t.Fatalf("restrictChatMember calls = %v, want rights in the first chat", restricts)
+	}
+	if queue := cache.WelcomeQueue(); len(queue) != 1 || queue[0].ChatID != otherChatID {
+		t.Fatalf("welcome queue = %v, want the other chat welcome kept", queue)
+	}
+	if cache.GetMember(testUser.ID, otherChatID) == nil {
+		t.Errorf("member of the other chat is removed")
+	}
+
+	scheduler.runDue(queue[1].Timestamp.Add(time.Second))
+	kicks := fake.methodCalls("banChatMember")
+	if len(kicks) != 1 || kicks[0].Params.Get("chat_id") != strconv.Itoa(otherChatID) {
+		t.Errorf("banChatMember calls = %v, want timeout in the other chat", kicks)
+	}
+}
+
+func Test_schedulerSolvedChallenge(t *testing.T) {
+	fake := setupTestBot(t)
+	processUpdate(joinUpdate(testUser))
+	welcome := cache.WelcomeQueue()[0]
+	processUpdate(tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:      "1",
+		From:    &testUser,
+		Message: &tgbotapi.Message{MessageID: welcome.ID, Chat: tgbotapi.Chat{ID: testChatID}},
+		Data:    `{"command": "upgrade_rights", "data": "` + strconv.FormatInt(testUser.ID, 10) + `"}`,
+	}})
+	fake.reset()
+
+	if counter := scheduler.runDue(welcome.Timestamp.Add(time.Second)); counter != 1 {
+		t.Errorf("runDue() = %d, want timeout job", counter)
+	}
+	if kicks := fake.methodCalls("banChatMember"); len(kicks) != 0 {
+		t.Errorf("banChatMember calls = %v, want no kick after solved challenge", kicks)
+	}
+}
+
+func Test_migrateQueues(t *testing.T) {
+	fake := setupTestBot(t)
+	expired := time.Now().UTC().Add(-time.Minute)
+	cache.AddTrigger(WelcomeMessage{ID: 5, UserID: testUser.ID, ChatID: testChatID, Timestamp: expired})
+	cache.AddWelcome(WelcomeMessage{ID: 6, UserID: testUser.ID, ChatID: testChatID, Timestamp: expired})
+
+	migrateQueues()
+	scheduler.load()
+	if queue := cache.TriggerQueue(); len(queue) != 0 {
+		t.Errorf("trigger queue = %v, want moved to jobs", queue)
+	}
+	if counter := scheduler.runDue(time.Now().UTC()); counter != 2 {
+		t.Errorf("runDue() = %d, want trigger and welcome jobs", counter)
+	}
+	if deletes := fake.methodCalls("deleteMessage"); len(deletes) != 2 {
+		t.Errorf("deleteMessage calls = %v, want trigger and welcome deleted", deletes)
+	}
+}
+
+func joinRequestUpdate(user tgbotapi.User) tgbotapi.Update {
+	return tgbotapi.Update{ChatJoinRequest: &tgbotapi.ChatJoinRequest{
+		Chat:       tgbotapi.Chat{ID: testChatID, Type: "supergroup"},
+		From:       user,
+		UserChatID: user.ID,
+		Date:       int(time.Now().Unix()),
+	}}
+}
+
+func Test_joinRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		challenge   string
+		casBanned   bool
+		badName     bool
+		right       bool
+		wantApprove bool
+		wantDecline bool
+		wantBan     bool
+	}{
+		{"RightAnswer", "arithmetic", false, false, true, true, false, false},
+		{"WrongAnswer", "arithmetic", false, false, false, false, true, false},
+		{"TypedAnswer", "text", false, false, true, true, false, false},
+		{"Button", "button", false, false, true, true, false, false},
+		{"ApiBanned", "arithmetic", true, false, false, false, true, true},
+		{"BadName", "arithmetic", false, true, false, false, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := setupTestBot(t)
+			chat := MainConfig.Chats[testChatID]
+			chat.JoinRequests = true
+			chat.Challenge = tt.challenge
+			if tt.badName {
+				chat.DenyNames = []string{"newbie"}
+			}
+			MainConfig.Chats[testChatID] = chat
+			if err := readDenyNames(); err != nil {
+				t.Fatal(err)
+			}
+			fake.casBanned[testUser.ID] = tt.casBanned
+
+			processUpdate(joinRequestUpdate(testUser))
+
+			if queue := cache.WelcomeQueue(); len(queue) == 1 {
+				welcome := queue[0]
+				if welcome.ChatID != testUser.ID || welcome.JoinChat != testChatID {
+					t.Fatalf("welcome = %+v, want challenge in private chat for the join chat", welcome)
+				}
+				answer := welcome.Answer
+				if !tt.right {
+					answer += "0"
+				}
+				switch tt.challenge {
+				case "text":
+					update := messageUpdate(testUser, answer)
+					update.Message.Chat = tgbotapi.Chat{ID: testUser.ID, Type: "private"}
+					processUpdate(update)
+				case "button":
+					processUpdate(tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+						ID:      "1",
+						From:    &testUser,
+						Message: &tgbotapi.Message{MessageID: welcome.ID, Chat: tgbotapi.Chat{ID: testUser.ID, Type: "private"}},
+						Data:    `{"command": "upgrade_rights", "data": "` + strconv.FormatInt(testUser.ID, 10) + `"}`,
+					}})
+				default:
+					update := answerUpdate(welcome.ID, answer)
+					update.CallbackQuery.Message.Chat = tgbotapi.Chat{ID: testUser.ID, Type: "private"}
+					processUpdate(update)
+				}
+			} else if !tt.casBanned && !tt.badName {
+				t.Fatalf("welcome queue = %v, want one challenge", queue)
+			}
+
+			if approves := fake.methodCalls("approveChatJoinRequest"); (len(approves) == 1) != tt.wantApprove {
+				t.Errorf("approveChatJoinRequest calls = %v, want %v", approves, tt.wantApprove)
+			}
+			if declines := fake.methodCalls("declineChatJoinRequest"); (len(declines) == 1) != tt.wantDecline {
+				t.Errorf("declineChatJoinRequest calls = %v, want %v", declines, tt.wantDecline)
+			}
+			if ban := cache.GetBan(testUser.ID) != nil; ban != tt.wantBan {
+				t.Errorf("local ban = %v, want %v", ban, tt.wantBan)
+			}
+			if queue := cache.WelcomeQueue(); len(queue) != 0 {
+				t.Errorf("welcome queue = %v, want empty", queue)
+			}
+		})
+	}
+}
+
+func Test_joinRequestDisabled(t *testing.T) {
+	fake := setupTestBot(t)
+
+	processUpdate(joinRequestUpdate(testUser))
+
+	if calls := fake.methodCalls("sendMessage"); len(calls) != 0 {
+		t.Errorf("sendMessage calls = %v, want requests left to admins", calls)
+	}
+}
+
+// Join request questions are in private chat, settings are of the join chat
+func Test_joinRequestChatSettings(t *testing.T) {
+	fake := setupTestBot(t)
+	chat := MainConfig.Chats[testChatID]
+	chat.JoinRequests = true
+	chat.Challenge = "arithmetic"
+	chat.CaptchaTimeout = 3 * time.Minute
+	chat.CaptchaAttempts = 1
+	chat.CaptchaAction = CAPTCHA_ACTION_BAN
+	MainConfig.Chats[testChatID] = chat
+
+	processUpdate(joinRequestUpdate(testUser))
+	queue := cache.WelcomeQueue()
+	if len(queue) != 1 {
+		t.Fatalf("welcome queue = %v, want one challenge", queue)
+	}
+	if left := time.Until(queue[0].Timestamp); left < 2*time.Minute || left > 3*time.Minute {
+		t.Errorf("challenge expires in %s, want captcha_timeout of the join chat", left)
+	}
+
+	answer := func() {
+		update := answerUpdate(queue[0].ID, queue[0].Answer+"0")
+		update.CallbackQuery.Message.Chat = tgbotapi.Chat{ID: testUser.ID, Type: "private"}
+		processUpdate(update)
+	}
+	answer()
+	if declines := fake.methodCalls("declineChatJoinRequest"); len(declines) != 0 {
+		t.Fatalf("declineChatJoinRequest calls = %v, want first wrong answer forgiven", declines)
+	}
+	if queue := cache.WelcomeQueue(); len(queue) != 1 || queue[0].Attempts != 1 {
+		t.Fatalf("welcome queue = %v, want one attempt", queue)
+	}
+
+	answer()
+	if declines := fake.methodCalls("declineChatJoinRequest"); len(declines) != 1 {
+		t.Errorf("declineChatJoinRequest calls = %v, want decline after the second wrong answer", declines)
+	}
+	if cache.GetBan(testUser.ID) == nil {
+		t.Errorf("local ban is not added, want captcha_action of the join chat")
+	}
+}
+
+func Test_joinRequestApprovedMember(t *testing.T) {
+	tests := []struct {
+		name       string
+		spamFactor float64
+		wantMedia  bool
+	}{
+		{"TierRights", 0.4, true},
+		{"RestrictMedia", 0.7, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := setupTestBot(t)
+			setBanPolicy()
+			chat := MainConfig.Chats[testChatID]
+			chat.JoinRequests = true
+			MainConfig.Chats[testChatID] = chat
+			fake.spamFactor[testUser.ID] = tt.spamFactor
+
+			update := joinUpdate(testUser)
+			update.ChatMember.ViaJoinRequest = true
+			processUpdate(update)
+
+			if welcomes := fake.methodCalls("sendMessage"); len(welcomes) != 0 {
+				t.Errorf("sendMessage calls = %v, want no second challenge", welcomes)
+			}
+			restricts := fake.methodCalls("restrictChatMember")
+			if len(restricts) != 1 || !strings.Contains(restricts[0].Params.Get("permissions"), `"can_send_messages":true`) {
+				t.Fatalf("restrictChatMember calls = %v, want tier rights", restricts)
+			}
+			if media := strings.Contains(restricts[0].Params.Get("permissions"), `"can_send_photos":true`); media != tt.wantMedia {
+				t.Errorf("permissions = %s, want media %v", restricts[0].Params.Get("permissions"), tt.wantMedia)
+			}
+			if stats := cache.GetStats(testUser.ID, testChatID); stats == nil || stats.Joined.IsZero() {
+				t.Errorf("stats = %+v, want join time for rights tiers", stats)
+			}
+		})
+	}
+}
+
+func setDenyNames(t *testing.T, names ...string) {
+	chat := MainConfig.Chats[testChatID]
+	chat.DenyNames = names
+	MainConfig.Chats[testChatID] = chat
+	if err := readDenyNames(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_badNameOfJoiningUser(t *testing.T) {
+	fake := setupTestBot(t)
+	setDenyNames(t, "newbie")
+
+	// Admin adds a user, admin name is not checked
+	update := joinUpdate(testUser)
+	update.ChatMember.From = tgbotapi.User{ID: testAdminID, FirstName: "Admin"}
+	processUpdate(update)
+	if bans := fake.methodCalls("banChatMember"); len(bans) != 1 || bans[0].Params.Get("user_id") != strconv.FormatInt(testUser.ID, 10) {
+		t.Errorf("banChatMember calls = %v, want joining user banned", bans)
+	}
+
+	fake = setupTestBot(t)
+	setDenyNames(t, "admin")
+	processUpdate(update)
+	if bans := fake.methodCalls("banChatMember"); len(bans) != 0 {
+		t.Errorf("banChatMember calls = %v, want no ban for the name of admin", bans)
+	}
+}
+
+func Test_badNameAfterRename(t *testing.T) {
+	fake := setupTestBot(t)
+	setDenyNames(t, "r:fr[e3]{2} m[o0]ney")
+
+	processUpdate(messageUpdate(testUser, "hello everyone"))
+	if bans := fake.methodCalls("banChatMember"); len(bans) != 0 {
+		t.Fatalf("banChatMember calls = %v, want no ban", bans)
+	}
+
+	renamed := testUser
+	renamed.FirstName = "Frее Мoney" //Cyrillic е and М
+	processUpdate(messageUpdate(renamed, "hello everyone"))
+	if bans := fake.methodCalls("banChatMember"); len(bans) != 1 {
+		t.Errorf("banChatMember calls = %v, want renamed member banned", bans)
+	}
+	if deletes := fake.methodCalls("deleteMessage"); len(deletes) != 1 {
+		t.Errorf("deleteMessage calls = %v, want message deleted", deletes)
+	}
+}
+
+func Test_forbiddenTextActions(t *testing.T) {
+	tests := []struct {
+		action   string
+		wantSent int
+		wantMute bool
+		wantBan  bool
+		wantJobs int
+	}{
+		{RULE_ACTION_DELETE, 0, false, false, 0},
+		{RULE_ACTION_WARN, 1, false, false, 1},
+		{RULE_ACTION_MUTE, 0, true, false, 1},
+		{RULE_ACTION_BAN, 0, false, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			fake := setupTestBot(t)
+			chat := MainConfig.Chats[testChatID]
+			chat.ForbiddenText = []ForbiddenRule{{Text: "casino", Normalize: true, Action: tt.action}}
+			MainConfig.Chats[testChatID] = chat
+			if err := readForbiddenText(); err != nil {
+				t.Fatal(err)
+			}
+
+			processUpdate(messageUpdate(testUser, "best c a s i n o"))
+
+			if deletes := fake.methodCalls("deleteMessage"); len(deletes) != 1 {
+				t.Errorf("deleteMessage calls = %v, want message deleted", deletes)
+			}
+			if sent := fake.methodCalls("sendMessage"); len(sent) != tt.wantSent {
+				t.Errorf("sendMessage calls = %v, want %d", sent, tt.wantSent)
+			}
+			restricts := fake.methodCalls("restrictChatMember")
+			if mute := len(restricts) == 1 && restricts[0].Params.Get("until_date") != ""; mute != tt.wantMute {
+				t.Errorf("restrictChatMember calls = %v, want mute %v", restricts, tt.wantMute)
+			}
+			if ban := cache.GetBan(testUser.ID) != nil; ban != tt.wantBan {
+				t.Errorf("local ban = %v, want %v", ban, tt.wantBan)
+			}
+			if jobs := cache.Jobs(); len(jobs) != tt.wantJobs {
+				t.Errorf("jobs = %+v, want %d", jobs, tt.wantJobs)
+			}
+		})
+	}
+}
+
+func Test_filterEditedAndForwarded(t *testing.T) {
+	fake := setupTestBot(t)
+	chat := MainConfig.Chats[testChatID]
+	chat.ForbiddenText = []ForbiddenRule{{Text: "casino"}}
+	chat.DenyChats = []string{"spamchannel"}
+	MainConfig.Chats[testChatID] = chat
+	if err := readForbiddenText(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Spam edited into a clean message
+	edited := messageUpdate(testUser, "best casino")
+	edited.EditedMessage, edited.Message = edited.Message, nil
+	processUpdate(edited)
+	if deletes := fake.methodCalls("deleteMessage"); len(deletes) != 1 {
+		t.Fatalf("deleteMessage calls = %v, want edited message deleted", deletes)
+	}
+
+	// Photo with caption
+	fake.reset()
+	photo := messageUpdate(testUser, "")
+	photo.Message.Caption = "casino"
+	processUpdate(photo)
+	if deletes := fake.methodCalls("deleteMessage"); len(deletes) != 1 {
+		t.Fatalf("deleteMessage calls = %v, want captioned photo deleted", deletes)
+	}
+
+	// Forward from a user has no origin chat
+	fake.reset()
+	forward := messageUpdate(testUser, "hello")
+	forward.Message.ForwardOrigin = &tgbotapi.MessageOrigin{Type: "user", SenderUser: &tgbotapi.User{ID: 7}}
+	processUpdate(forward)
+	if deletes := fake.methodCalls("deleteMessage"); len(deletes) != 0 {
+		t.Fatalf("deleteMessage calls = %v, want forward from user kept", deletes)
+	}
+
+	forward.Message.ForwardOrigin = &tgbotapi.MessageOrigin{Type: "channel", Chat: &tgbotapi.Chat{ID: -100500, UserName: "SpamChannel"}}
+	processUpdate(forward)
+	if deletes := fake.methodCalls("deleteMessage"); len(deletes) != 1 {
+		t.Fatalf("deleteMessage calls = %v, want forward from denied channel deleted", deletes)
+	}
+}
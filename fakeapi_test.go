@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/OvyFlash/telegram-bot-api"
+)
+
+const fakeBotID = 100
+
+// fakeBotAPI is a local stand-in for Telegram Bot API server.
+// It records every call and answers with minimal valid responses.
+type fakeBotAPI struct {
+	server *httptest.Server
+
+	mu            sync.Mutex
+	calls         []fakeCall
+	updates       []tgbotapi.Update
+	lastMessageID int
+	// getChatMember answers by user id, plain member if not set
+	members map[int64]tgbotapi.ChatMember
+	// Users banned by CAS and lols.bot stand-ins
+	casBanned  map[int64]bool
+	lolsBanned map[int64]bool
+	// lols.bot spam_factor by user id
+	spamFactor map[int64]float64
+	// Files to download by file id
+	files map[string][]byte
+}
+
+type fakeCall struct {
+	Method string
+	Params url.Values
+}
+
+func newFakeBotAPI(t *testing.T) *fakeBotAPI {
+	fake := &fakeBotAPI{
+		lastMessageID: 1000,
+		members:       make(map[int64]tgbotapi.ChatMember),
+		casBanned:     make(map[int64]bool),
+		lolsBanned:    make(map[int64]bool),
+		spamFactor:    make(map[int64]float64),
+		files:         make(map[string][]byte),
+	}
+	fake.server = httptest.NewServer(http.HandlerFunc(fake.handle))
+	t.Cleanup(fake.server.Close)
+	return fake
+}
+
+// endpoint to pass as api_endpoint
+func (f *fakeBotAPI) endpoint() string {
+	return f.server.URL + "/bot%s/%s"
+}
+
+func (f *fakeBotAPI) handle(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/cas/check":
+		f.handleBanCheck(w, r.URL.Query().Get("user_id"), f.casBanned, "ok")
+		return
+	case r.URL.Path == "/lols/account":
+		f.handleBanCheck(w, r.URL.Query().Get("id"), f.lolsBanned, "banned")
+		return
+	case strings.HasPrefix(r.URL.Path, "/file/"):
+		f.mu.Lock()
+		data, ok := f.files[path.Base(r.URL.Path)]
+		f.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+		return
+	}
+
+	if err := r.ParseMultipartForm(1 << 20); err != nil && err != http.ErrNotMultipart {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	method := path.Base(r.URL.Path)
+	if method == "getUpdates" {
+		f.writeResult(w, f.popUpdates())
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, fakeCall{Method: method, Params: r.Form})
+
+	var result any = true
+	switch method {
+	case "getMe":
+		result = tgbotapi.User{ID: fakeBotID, IsBot: true, FirstName: "Fake", UserName: "fakebot"}
+	case "sendMessage", "sendPhoto", "sendDocument", "copyMessage":
+		f.lastMessageID++
+		chatID, _ := strconv.ParseInt(r.Form.Get("chat_id"), 10, 64)
+		result = tgbotapi.Message{
+			MessageID: f.lastMessageID,
+			From:      &tgbotapi.User{ID: fakeBotID, IsBot: true, UserName: "fakebot"},
+			Chat:      tgbotapi.Chat{ID: chatID},
+			Date:      int(time.Now().Unix()),
+			Text:      r.Form.Get("text"),
+		}
+	case "getChatMember":
+		userID, _ := strconv.ParseInt(r.Form.Get("user_id"), 10, 64)
+		member, ok := f.members[userID]
+		if !ok {
+			member = tgbotapi.ChatMember{Status: "member", User: &tgbotapi.User{ID: userID}}
+		}
+		result = member
+	case "getChatAdministrators":
+		result = []tgbotapi.ChatMember{}
+	case "getFile":
+		fileID := r.Form.Get("file_id")
+		result = tgbotapi.File{FileID: fileID, FilePath: "documents/" + fileID}
+	}
+	f.writeResult(w, result)
+}
+
+func (f *fakeBotAPI) handleBanCheck(w http.ResponseWriter, id string, banned map[int64]bool, field string) {
+	userID, _ := strconv.ParseInt(id, 10, 64)
+	f.mu.Lock()
+	response := map[string]any{field: banned[userID]}
+	if spamFactor, ok := f.spamFactor[userID]; ok && field == "banned" {
+		response["spam_factor"] = spamFactor
+	}
+	f.mu.Unlock()
+	json.NewEncoder(w).Encode(response)
+}
+
+func (f *fakeBotAPI) writeResult(w http.ResponseWriter, result any) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(tgbotapi.APIResponse{Ok: true, Result: data})
+}
+
+func (f *fakeBotAPI) popUpdates() []tgbotapi.Update {
+	f.mu.Lock()
+	updates := f.updates
+	f.updates = nil
+	f.mu.Unlock()
+	if len(updates) == 0 {
+		// Don't spin the polling loop
+		time.Sleep(10 * time.Millisecond)
+	}
+	return updates
+}
+
+// pushUpdate queues update for the next getUpdates
+func (f *fakeBotAPI) pushUpdate(update tgbotapi.Update) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.updates = append(f.updates, update)
+}
+
+// methodCalls returns recorded calls of the method
+func (f *fakeBotAPI) methodCalls(method string) []fakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var calls []fakeCall
+	for _, call := range f.calls {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+func (f *fakeBotAPI) reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = nil
+}
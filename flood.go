@@ -0,0 +1,191 @@
+package main
+
+/*
+ - Flood: more than `flood_messages` messages of a user in one chat within `flood_window`.
+ - Duplicates: the same text of a user posted `duplicate_messages` times within `duplicate_window`,
+   in any managed chats. Texts are normalized and hashed, all copies are deleted.
+ - Actions: delete, warn, mute for `flood_duration`/`duplicate_duration`, ban.
+   The sanction is applied once per window, later messages of the burst are only deleted.
+ - Counters are in memory, they are short-lived.
+*/
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/OvyFlash/telegram-bot-api"
+)
+
+const DEFAULT_FLOOD_WINDOW = 10 * time.Second
+const DEFAULT_DUPLICATE_WINDOW = 10 * time.Minute
+
+type messageRef struct {
+	ChatID    int64
+	MessageID int
+}
+
+type duplicateEntry struct {
+	last   time.Time
+	copies []messageRef //Not deleted yet
+	spam   bool         //Later copies are deleted at once
+}
+
+type floodDetector struct {
+	mu         sync.Mutex
+	messages   map[string][]time.Time //chat:user => message times
+	duplicates map[string]*duplicateEntry
+	punished   map[string]time.Time //key => sanctioned until
+	swept      time.Time
+}
+
+var flood = newFloodDetector()
+
+func newFloodDetector() *floodDetector {
+	return &floodDetector{messages: map[string][]time.Time{}, duplicates: map[string]*duplicateEntry{}, punished: map[string]time.Time{}}
+}
+
+// isFlood counts the message, true if there are more than limit messages in the window
+func (d *floodDetector) isFlood(key string, at time.Time, limit int, window time.Duration) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sweep(at)
+	times := append(d.messages[key], at)
+	start := 0
+	for start < len(times) && at.Sub(times[start]) >= window {
+		start++
+	}
+	d.messages[key] = times[start:]
+	return len(d.messages[key]) > limit
+}
+
+// duplicateCopies remembers the copy, returns copies to delete when there are count of them
+func (d *floodDetector) duplicateCopies(key string, ref messageRef, at time.Time, count int, window time.Duration) []messageRef {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sweep(at)
+	entry := d.duplicates[key]
+	if entry == nil || at.Sub(entry.last) >= window {
+		entry = &duplicateEntry{}
+		d.duplicates[key] = entry
+	}
+	entry.last = at
+	entry.copies = append(entry.copies, ref)
+	if !entry.spam && len(entry.copies) < count {
+		return nil
+	}
+	copies := entry.copies
+	entry.copies, entry.spam = nil, true
+	return copies
+}
+
+// punish marks the key as sanctioned until the time, false if it already is
+func (d *floodDetector) punish(key string, at time.Time, until time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.punished[key].After(at) {
+		return false
+	}
+	d.punished[key] = until
+	return true
+}
+
+// sweep forgets quiet users once a minute, windows are shorter than an hour
+func (d *floodDetector) sweep(now time.Time) {
+	if now.Sub(d.swept) < time.Minute {
+		return
+	}
+	d.swept = now
+	for key, times := range d.messages {
+		if len(times) == 0 || now.Sub(times[len(times)-1]) > time.Hour {
+			delete(d.messages, key)
+		}
+	}
+	for key, entry := range d.duplicates {
+		if now.Sub(entry.last) > time.Hour {
+			delete(d.duplicates, key)
+		}
+	}
+	for key, until := range d.punished {
+		if !until.After(now) {
+			delete(d.punished, key)
+		}
+	}
+}
+
+// duplicateKey hashes the normalized text, spacing and look-alike letters don't matter
+func duplicateKey(userID int64, text string) string {
+	sum := sha256.Sum256([]byte(strings.Join(strings.Fields(normalizeText(text)), " ")))
+	return fmt.Sprintf("%d:%x", userID, sum)
+}
+
+// checkFlood applies flood and duplicate actions, true if the message is deleted
+func checkFlood(chat ChatConfig, message *tgbotapi.Message) bool {
+	// Edits are not new messages
+	if message.From == nil || message.EditDate != 0 || message.Chat.IsPrivate() {
+		return false
+	}
+	at := message.Time()
+
+	if chat.FloodMessages > 0 {
+		window := chat.FloodWindow
+		if window <= 0 {
+			window = DEFAULT_FLOOD_WINDOW
+		}
+		key := fmt.Sprintf("%d:%d", message.Chat.ID, message.From.ID)
+		if flood.isFlood(key, at, chat.FloodMessages, window) {
+			slog.Info(fmt.Sprintf("Flood from %s(%d) in chat %d", message.From.UserName, message.From.ID, message.Chat.ID))
+			// One burst is one offense, warnings would escalate to ban in seconds
+			if flood.punish(key, at, at.Add(window)) {
+				applyAction(message, chat.FloodAction, chat.FloodDuration, "flood")
+			} else {
+				removeMessage(message, 0, "flood")
+			}
+			return true
+		}
+	}
+
+	text := message.Text + message.Caption
+	if chat.DuplicateMessages > 1 && utf8.RuneCountInString(text) >= chat.DuplicateMinLength && strings.TrimSpace(text) != "" {
+		window := chat.DuplicateWindow
+		if window <= 0 {
+			window = DEFAULT_DUPLICATE_WINDOW
+		}
+		current := messageRef{ChatID: message.Chat.ID, MessageID: message.MessageID}
+		key := duplicateKey(message.From.ID, text)
+		copies := flood.duplicateCopies(key, current, at, chat.DuplicateMessages, window)
+		if copies != nil {
+			slog.Info(fmt.Sprintf("Duplicate from %s(%d), copies %d", message.From.UserName, message.From.ID, len(copies)))
+			for _, ref := range copies {
+				if ref != current {
+					deleteMessage(ref.ChatID, ref.MessageID)
+					logModeration(ModerationEntry{Action: "delete", ChatID: ref.ChatID, UserID: message.From.ID, Reason: "duplicate messages", MessageID: ref.MessageID})
+				}
+			}
+			if flood.punish(key, at, at.Add(window)) {
+				applyAction(message, chat.DuplicateAction, chat.DuplicateDuration, "duplicate messages")
+			} else {
+				removeMessage(message, 0, "duplicate messages")
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// readFloodPolicy checks flood and duplicate actions of all chats
+func readFloodPolicy() error {
+	for _, chat := range allChatConfigs() {
+		if !isAction(chat.FloodAction) {
+			return fmt.Errorf("chat %d: unknown flood_action %q", chat.ID, chat.FloodAction)
+		}
+		if !isAction(chat.DuplicateAction) {
+			return fmt.Errorf("chat %d: unknown duplicate_action %q", chat.ID, chat.DuplicateAction)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/OvyFlash/telegram-bot-api"
+)
+
+func Test_floodWindow(t *testing.T) {
+	d := newFloodDetector()
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if d.isFlood("1:1", start.Add(time.Duration(i)*time.Second), 3, 10*time.Second) {
+			t.Fatalf("message %d is flood, limit is 3", i+1)
+		}
+	}
+	if !d.isFlood("1:1", start.Add(3*time.Second), 3, 10*time.Second) {
+		t.Fatal("4th message in window is not flood")
+	}
+	if d.isFlood("1:2", start.Add(3*time.Second), 3, 10*time.Second) {
+		t.Fatal("other user is flood")
+	}
+	// Window slid past the first two messages
+	if d.isFlood("1:1", start.Add(11*time.Second), 3, 10*time.Second) {
+		t.Fatal("message after window is flood")
+	}
+}
+
+func Test_floodSanctionOnce(t *testing.T) {
+	const limit = 3
+	fake := setupTestBot(t)
+	chat := MainConfig.Chats[testChatID]
+	chat.FloodMessages = limit
+	chat.FloodAction = RULE_ACTION_WARN
+	MainConfig.Chats[testChatID] = chat
+
+	for i := 0; i < limit+3; i++ {
+		update := messageUpdate(testUser, "hello there")
+		update.Message.MessageID = 100 + i
+		processUpdate(update)
+	}
+	if warnings := cache.Warnings(testUser.ID, testChatID, time.Now().UTC()); len(warnings) != 1 {
+		t.Errorf("warnings = %v, want one for the burst", warnings)
+	}
+	if restricts := fake.methodCalls("restrictChatMember"); len(restricts) != 0 {
+		t.Errorf("restrictChatMember calls = %v, want no escalation", restricts)
+	}
+	if deletes := fake.methodCalls("deleteMessage"); len(deletes) != 3 {
+		t.Errorf("deleteMessage calls = %v, want messages over the limit deleted", deletes)
+	}
+
+	// Next window is the next offense
+	flood.punished[fmt.Sprintf("%d:%d", testChatID, testUser.ID)] = time.Now().Add(-time.Second)
+	processUpdate(messageUpdate(testUser, "hello there"))
+	if warnings := cache.Warnings(testUser.ID, testChatID, time.Now().UTC()); len(warnings) != 2 {
+		t.Errorf("warnings = %v, want the second after the window", warnings)
+	}
+}
+
+func Test_duplicateKey(t *testing.T) {
+	if duplicateKey(1, "Buy  CHEAP crypto") != duplicateKey(1, "buy cheap\ncrуpto") {
+		t.Error("normalized copies have different keys")
+	}
+	if duplicateKey(1, "buy cheap crypto") == duplicateKey(2, "buy cheap crypto") {
+		t.Error("copies of different users have one key")
+	}
+}
+
+func Test_floodActions(t *testing.T) {
+	fake := setupTestBot(t)
+	chat := MainConfig.Chats[testChatID]
+	chat.FloodMessages = 2
+	chat.FloodAction = RULE_ACTION_MUTE
+	chat.FloodDuration = 10 * time.Minute
+	MainConfig.Chats[testChatID] = chat
+
+	for i := 0; i < 3; i++ {
+		processUpdate(messageUpdate(testUser, "hello there"))
+	}
+	if deletes := fake.methodCalls("deleteMessage"); len(deletes) != 1 {
+		t.Fatalf("deleteMessage calls = %v, want 3rd message deleted", deletes)
+	}
+	restricts := fake.methodCalls("restrictChatMember")
+	if len(restricts) != 1 || restricts[0].Params.Get("until_date") == "" {
+		t.Fatalf("restrictChatMember calls = %v, want mute", restricts)
+	}
+}
+
+func Test_duplicateAcrossChats(t *testing.T) {
+	fake := setupTestBot(t)
+	const otherChatID = -1002
+	chat := MainConfig.Chats[testChatID]
+	chat.DuplicateMessages = 2
+	chat.DuplicateMinLength = 10
+	chat.DuplicateAction = RULE_ACTION_BAN
+	MainConfig.Chats[testChatID] = chat
+	other := chat
+	other.ID = otherChatID
+	MainConfig.Chats[otherChatID] = other
+
+	processUpdate(messageUpdate(testUser, "ok"))
+	processUpdate(messageUpdate(testUser, "ok"))
+	if deletes := fake.methodCalls("deleteMessage"); len(deletes) != 0 {
+		t.Fatalf("deleteMessage calls = %v, want short copies kept", deletes)
+	}
+
+	processUpdate(messageUpdate(testUser, "Best crypto signals here"))
+	second := messageUpdate(testUser, "best  crypto signals HERE")
+	second.Message.Chat = tgbotapi.Chat{ID: otherChatID, Type: "supergroup"}
+	second.Message.MessageID = 78
+	processUpdate(second)
+
+	deletes := fake.methodCalls("deleteMessage")
+	if len(deletes) != 2 || deletes[0].Params.Get("message_id") != "77" || deletes[1].Params.Get("chat_id") != "-1002" {
+		t.Fatalf("deleteMessage calls = %v, want both copies deleted", deletes)
+	}
+	if cache.GetBan(testUser.ID) == nil {
+		t.Fatal("user is not banned")
+	}
+}
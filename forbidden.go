@@ -0,0 +1,256 @@
+package main
+
+/*
+ - `forbiddenText` rules are compiled on config load, broken rules stop the load.
+ - A rule is a string: substring or regex with `r:` prefix, or a map with flags:
+   case_insensitive, whole_word, normalize(look-alike letters, s p a c e d and d.o.t.t.e.d words).
+ - Normalized regex rules are case-insensitive and match the text with look-alike letters replaced or as is,
+   spacing and punctuation are kept.
+ - Per-rule action: delete(default), warn, mute for `duration`, ban.
+ - Rules see every text of a message: text, caption, link targets, buttons and polls, edited messages too.
+*/
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	tgbotapi "github.com/OvyFlash/telegram-bot-api"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	RULE_ACTION_DELETE = "delete"
+	RULE_ACTION_WARN   = "warn"
+	RULE_ACTION_MUTE   = "mute"
+	RULE_ACTION_BAN    = "ban"
+)
+
+const DEFAULT_MUTE_DURATION = time.Hour
+const RULE_WARN_MESSAGE = "{namelink}, the message is deleted, it breaks the chat rules"
+
+// Warnings are deleted after
+const RULE_WARN_TTL = time.Minute
+
+type ForbiddenRule struct {
+	Text            string        `yaml:"text"`
+	Regex           bool          `yaml:"regex"`
+	CaseInsensitive bool          `yaml:"case_insensitive"`
+	WholeWord       bool          `yaml:"whole_word"`
+	Normalize       bool          `yaml:"normalize"`
+	Action          string        `yaml:"action"`   //delete, warn, mute or ban
+	Duration        time.Duration `yaml:"duration"` //For mute
+
+	regex *regexp.Regexp
+}
+
+// UnmarshalYAML accepts old string rules too
+func (rule *ForbiddenRule) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*rule = ForbiddenRule{Text: value.Value}
+		if regex, ok := strings.CutPrefix(value.Value, "r:"); ok {
+			rule.Text, rule.Regex = regex, true
+		}
+		return nil
+	}
+	type plain ForbiddenRule
+	return value.Decode((*plain)(rule))
+}
+
+func (rule *ForbiddenRule) compile() error {
+	if strings.TrimSpace(rule.Text) == "" {
+		return fmt.Errorf("empty forbiddenText rule")
+	}
+	if !isAction(rule.Action) {
+		return fmt.Errorf("forbiddenText %q: unknown action %q", rule.Text, rule.Action)
+	}
+
+	pattern := rule.Text
+	// Lowercasing would turn \S into \s, regex source is not normalized
+	if rule.Normalize && !rule.Regex {
+		pattern = squeezeSpacing(normalizeText(pattern))
+	}
+	if !rule.Regex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if rule.WholeWord {
+		// \b knows only ASCII letters
+		pattern = `(?:^|[^\p{L}\p{N}_])(?:` + pattern + `)(?:$|[^\p{L}\p{N}_])`
+	}
+	// Normalized text is lowercase
+	if rule.CaseInsensitive || rule.Normalize && rule.Regex {
+		pattern = "(?i)" + pattern
+	}
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("forbiddenText %q: %w", rule.Text, err)
+	}
+	rule.regex = regex
+	return nil
+}
+
+// isAction is true for actions of applyAction, empty is delete
+func isAction(action string) bool {
+	switch action {
+	case "", RULE_ACTION_DELETE, RULE_ACTION_WARN, RULE_ACTION_MUTE, RULE_ACTION_BAN:
+		return true
+	}
+	return false
+}
+
+// match checks the text as is, also normalized for regex rules or normalized and squeezed for substrings
+func (rule ForbiddenRule) match(text string, normalized string, squeezed string) bool {
+	if rule.regex == nil {
+		return false
+	}
+	switch {
+	case rule.Normalize && rule.Regex:
+		return rule.regex.MatchString(normalized) || rule.regex.MatchString(text)
+	case rule.Normalize:
+		return rule.regex.MatchString(squeezed)
+	}
+	return rule.regex.MatchString(text)
+}
+
+// squeezeSpacing joins letters split by spaces or punctuation: "s p a m", "s.p.a.m"
+func squeezeSpacing(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	var squeezed []string
+	letters := ""
+	for _, word := range words {
+		if utf8.RuneCountInString(word) == 1 {
+			letters += word
+			continue
+		}
+		if letters != "" {
+			squeezed = append(squeezed, letters)
+			letters = ""
+		}
+		squeezed = append(squeezed, word)
+	}
+	if letters != "" {
+		squeezed = append(squeezed, letters)
+	}
+	return strings.Join(squeezed, " ")
+}
+
+func compileForbiddenText(rules []ForbiddenRule) ([]ForbiddenRule, error) {
+	compiled := make([]ForbiddenRule, 0, len(rules))
+	for _, rule := range rules {
+		if err := rule.compile(); err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, rule)
+	}
+	return compiled, nil
+}
+
+// readForbiddenText compiles `forbiddenText` of all chats
+func readForbiddenText() error {
+	var err error
+	if MainConfig.ChatConfig.ForbiddenText, err = compileForbiddenText(MainConfig.ChatConfig.ForbiddenText); err != nil {
+		return err
+	}
+	for id, chat := range MainConfig.Chats {
+		if chat.ForbiddenText, err = compileForbiddenText(chat.ForbiddenText); err != nil {
+			return fmt.Errorf("chat %d: %w", id, err)
+		}
+		MainConfig.Chats[id] = chat
+	}
+	return nil
+}
+
+// findForbiddenRule returns the first rule matching the text
+func findForbiddenRule(chat ChatConfig, text string) *ForbiddenRule {
+	if text == "" {
+		return nil
+	}
+	normalized, squeezed := "", ""
+	for id, rule := range chat.ForbiddenText {
+		if rule.Normalize && normalized == "" {
+			normalized = normalizeText(text)
+			squeezed = squeezeSpacing(normalized)
+		}
+		if rule.match(text, normalized, squeezed) {
+			slog.Info("TriggeredBad: ", "term", rule.Text)
+			return &chat.ForbiddenText[id]
+		}
+	}
+	return nil
+}
+
+// messageTexts returns all texts of the message shown to readers
+func messageTexts(message *tgbotapi.Message) []string {
+	texts := []string{message.Text, message.Caption}
+	for _, entities := range [][]tgbotapi.MessageEntity{message.Entities, message.CaptionEntities} {
+		for _, entity := range entities {
+			texts = append(texts, entity.URL) //text_link targets
+		}
+	}
+	if message.ReplyMarkup != nil {
+		for _, row := range message.ReplyMarkup.InlineKeyboard {
+			for _, button := range row {
+				texts = append(texts, button.Text)
+				if button.URL != nil {
+					texts = append(texts, *button.URL)
+				}
+			}
+		}
+	}
+	if message.Poll != nil {
+		texts = append(texts, message.Poll.Question)
+		for _, option := range message.Poll.Options {
+			texts = append(texts, option.Text)
+		}
+	}
+	return texts
+}
+
+// findMessageRule returns the first rule matching any text of the message
+func findMessageRule(chat ChatConfig, message *tgbotapi.Message) *ForbiddenRule {
+	for _, text := range messageTexts(message) {
+		if rule := findForbiddenRule(chat, text); rule != nil {
+			return rule
+		}
+	}
+	return nil
+}
+
+// applyRuleAction deletes the message and punishes the sender as the rule says
+func applyRuleAction(rule *ForbiddenRule, message *tgbotapi.Message) {
+	applyAction(message, rule.Action, rule.Duration, "forbidden text")
+}
+
+// applyAction deletes the message and punishes the sender: warning, mute for duration or ban
+func applyAction(message *tgbotapi.Message, action string, duration time.Duration, reason string) {
+	removeMessage(message, 0, reason)
+	if message.From == nil {
+		return
+	}
+	switch action {
+	case RULE_ACTION_WARN:
+		result := warnUser(message.Chat.ID, message.From.ID, 0, reason)
+		text := strings.Replace(RULE_WARN_MESSAGE, "{namelink}", getNameLink(*message.From), -1) + " (" + result + ")"
+		msg := tgbotapi.NewMessage(message.Chat.ID, text)
+		msg.ParseMode = "HTML"
+		sent, err := bot.Send(msg)
+		if err != nil {
+			slog.Warn("Warning message error:", "error", err)
+			return
+		}
+		schedule(Job{Kind: JOB_DELETE_MESSAGE, ChatID: sent.Chat.ID, MessageID: sent.MessageID, Due: time.Now().UTC().Add(RULE_WARN_TTL)})
+	case RULE_ACTION_MUTE:
+		if duration == 0 {
+			duration = DEFAULT_MUTE_DURATION
+		}
+		muteUser(message.Chat.ID, message.From.ID, duration, 0, reason)
+	case RULE_ACTION_BAN:
+		banUser(message.Chat.ID, message.From.ID, 0, reason)
+	}
+}
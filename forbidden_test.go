@@ -0,0 +1,124 @@
+package main
+
+import (
+	"testing"
+
+	tgbotapi "github.com/OvyFlash/telegram-bot-api"
+	"gopkg.in/yaml.v3"
+)
+
+func Test_forbiddenRuleYaml(t *testing.T) {
+	var rules []ForbiddenRule
+	err := yaml.Unmarshal([]byte(`
+- "пишите в личку"
+- "r:циф[рp]"
+- text: casino
+  whole_word: true
+  action: ban
+`), &rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ForbiddenRule{
+		{Text: "пишите в личку"},
+		{Text: "циф[рp]", Regex: true},
+		{Text: "casino", WholeWord: true, Action: RULE_ACTION_BAN},
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("rules = %+v, want %+v", rules, want)
+	}
+	for id := range want {
+		if rules[id] != want[id] {
+			t.Errorf("rule %d = %+v, want %+v", id, rules[id], want[id])
+		}
+	}
+}
+
+func Test_forbiddenRuleCompile(t *testing.T) {
+	tests := []struct {
+		name string
+		rule ForbiddenRule
+	}{
+		{"Empty", ForbiddenRule{Text: " "}},
+		{"BrokenRegex", ForbiddenRule{Text: "(", Regex: true}},
+		{"UnknownAction", ForbiddenRule{Text: "spam", Action: "explode"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := compileForbiddenText([]ForbiddenRule{tt.rule}); err == nil {
+				t.Errorf("compileForbiddenText(%+v) = nil error", tt.rule)
+			}
+		})
+	}
+}
+
+func Test_findForbiddenRule(t *testing.T) {
+	tests := []struct {
+		name string
+		rule ForbiddenRule
+		text string
+		want bool
+	}{
+		{"Substring", ForbiddenRule{Text: "spam"}, "no spam here", true},
+		{"SubstringCase", ForbiddenRule{Text: "spam"}, "SPAM", false},
+		{"CaseInsensitive", ForbiddenRule{Text: "спам", CaseInsensitive: true}, "СПАМ", true},
+		{"Regex", ForbiddenRule{Text: `\d{3} usd`, Regex: true}, "earn 500 usd", true},
+		{"WholeWord", ForbiddenRule{Text: "кот", WholeWord: true}, "котлета", false},
+		{"WholeWordMatch", ForbiddenRule{Text: "кот", WholeWord: true}, "мой кот, да", true},
+		{"NotNormalized", ForbiddenRule{Text: "casino"}, "саsinо", false},
+		{"Homoglyphs", ForbiddenRule{Text: "casino", Normalize: true}, "саsinо", true},
+		{"Spaced", ForbiddenRule{Text: "казино", Normalize: true}, "лучшее к а з и н о", true},
+		{"Dotted", ForbiddenRule{Text: "casino", Normalize: true, WholeWord: true}, "go to c.a.s.i.n.o now", true},
+		{"NormalizedRegex", ForbiddenRule{Text: "cas[i1]no", Regex: true, Normalize: true}, "𝐂𝐀𝐒𝟏𝐍𝐎", true},
+		{"NormalizedRegexUpperEscape", ForbiddenRule{Text: `^\S+ usd$`, Regex: true, Normalize: true}, "500 usd", true},
+		{"NormalizedRegexUpperEscapeNotMatched", ForbiddenRule{Text: `\D{3}`, Regex: true, Normalize: true}, "1234", false},
+		{"NormalizedRegexUpperLetters", ForbiddenRule{Text: "CASINO", Regex: true, Normalize: true}, "саsinо", true},
+		{"NormalizedRegexPunctuation", ForbiddenRule{Text: `t\.me/\w+`, Regex: true, Normalize: true}, "join t.me/spam", true},
+		{"NormalizedRegexLookAlike", ForbiddenRule{Text: `t\.me/\w+`, Regex: true, Normalize: true}, "join т.ме/spam", true},
+		{"NormalizedRegexCyrillic", ForbiddenRule{Text: "крипт[оа]", Regex: true, Normalize: true}, "Лучшее КРИПТО тут", true},
+		{"Empty", ForbiddenRule{Text: "spam"}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := compileForbiddenText([]ForbiddenRule{tt.rule})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := findForbiddenRule(ChatConfig{ForbiddenText: rules}, tt.text) != nil; got != tt.want {
+				t.Errorf("findForbiddenRule(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_findMessageRule(t *testing.T) {
+	url := "https://casino.example"
+	tests := []struct {
+		name    string
+		message tgbotapi.Message
+		want    bool
+	}{
+		{"Text", tgbotapi.Message{Text: "casino"}, true},
+		{"Caption", tgbotapi.Message{Caption: "photo of casino"}, true},
+		{"TextLink", tgbotapi.Message{Text: "click", Entities: []tgbotapi.MessageEntity{{Type: "text_link", URL: url}}}, true},
+		{"CaptionLink", tgbotapi.Message{Caption: "click", CaptionEntities: []tgbotapi.MessageEntity{{Type: "text_link", URL: url}}}, true},
+		{"ButtonURL", tgbotapi.Message{Text: "hi", ReplyMarkup: &tgbotapi.InlineKeyboardMarkup{
+			InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{{{Text: "go", URL: &url}}}}}, true},
+		{"ButtonText", tgbotapi.Message{ReplyMarkup: &tgbotapi.InlineKeyboardMarkup{
+			InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{{tgbotapi.NewInlineKeyboardButtonData("casino", "x")}}}}, true},
+		{"PollQuestion", tgbotapi.Message{Poll: &tgbotapi.Poll{Question: "best casino?"}}, true},
+		{"PollOption", tgbotapi.Message{Poll: &tgbotapi.Poll{Question: "where?", Options: []tgbotapi.PollOption{{Text: "casino"}}}}, true},
+		{"Clean", tgbotapi.Message{Text: "hello", Caption: "photo", Entities: []tgbotapi.MessageEntity{{Type: "bold"}}}, false},
+	}
+	rules, err := compileForbiddenText([]ForbiddenRule{{Text: "casino"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findMessageRule(ChatConfig{ForbiddenText: rules}, &tt.message) != nil; got != tt.want {
+				t.Errorf("findMessageRule() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
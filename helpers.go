@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -16,23 +15,33 @@ func isWebhook() bool {
 	return MainConfig.Connection == "webhook"
 }
 
+func getApiEndpoint() string {
+	if MainConfig.ApiEndpoint != "" {
+		return MainConfig.ApiEndpoint
+	}
+	return tgbotapi.APIEndpoint
+}
+
+// getFileEndpoint follows api_endpoint, local Bot API server serves files too
+func getFileEndpoint() string {
+	if MainConfig.ApiEndpoint != "" {
+		return strings.Replace(MainConfig.ApiEndpoint, "/bot%s/%s", "/file/bot%s/%s", 1)
+	}
+	return tgbotapi.FileEndpoint
+}
+
 func isDebugMode() bool {
 	return strings.ToLower(os.Getenv("BOT_DEBUG")) == "true"
 }
 
 func isCachedUser(userid int64, chatid int64) bool {
-	newMember := getMember(userid)
-	if newMember == nil {
-		cache.Member = append(cache.Member, ChatMember{
-			Id:            userid,
-			WelcomeShowed: true,
-			Rank:          0,
-			MessageCount:  0,
-			ChatId:        chatid,
-		})
-		return true
-	}
-	return false
+	return cache.AddMember(ChatMember{
+		Id:            userid,
+		WelcomeShowed: true,
+		Rank:          0,
+		MessageCount:  0,
+		ChatId:        chatid,
+	})
 }
 
 func isNewMember(Member *tgbotapi.ChatMemberUpdated) bool {
@@ -47,11 +56,11 @@ func isNewMember(Member *tgbotapi.ChatMemberUpdated) bool {
 	return isCachedUser(Member.NewChatMember.User.ID, Member.Chat.ID)
 }
 
-func isMessageStartsWithEmoji(update tgbotapi.Update) bool {
-	if update.Message.Entities == nil {
+func isMessageStartsWithEmoji(message *tgbotapi.Message) bool {
+	if len(message.Entities) == 0 {
 		return false
 	}
-	if update.Message.Entities[0].Type == "custom_emoji" && update.Message.Entities[0].Offset == 0 && len(update.Message.Text) > 4 {
+	if message.Entities[0].Type == "custom_emoji" && message.Entities[0].Offset == 0 && len(message.Text) > 4 {
 		return true
 	}
 	return false
@@ -62,6 +71,13 @@ func kickChatMember(chatID int64, userID int64) {
 	//unbanChatMember(chatID, userID) //Unban and kick
 }
 
+// kickUser removes the user from the chat, the user can join again
+func kickUser(chatID int64, userID int64, adminID int64, reason string) {
+	BanChatMember(chatID, userID, time.Now().UTC().Add(time.Minute).Unix())
+	unbanChatMember(chatID, userID)
+	logModeration(ModerationEntry{Action: "kick", ChatID: chatID, UserID: userID, AdminID: adminID, Reason: reason})
+}
+
 func BanChatMember(chatID int64, userID int64, untilDate int64) {
 	//Ban for 11 months
 	if untilDate == 0 {
@@ -98,14 +114,56 @@ func unbanChatMember(chatID int64, userID int64) {
 	slog.Info(fmt.Sprintf("User unbanned: %d", userID))
 }
 
-func isChannelMessage(update tgbotapi.Update) bool {
-	return update.Message.SenderChat != nil
+// liftChatBan unbans without kicking users who are still in the chat
+func liftChatBan(chatID int64, userID int64) error {
+	config := tgbotapi.UnbanChatMemberConfig{
+		ChatMemberConfig: tgbotapi.ChatMemberConfig{
+			ChatConfig: tgbotapi.ChatConfig{
+				ChatID: chatID,
+			},
+			UserID: userID,
+		},
+		OnlyIfBanned: true,
+	}
+	_, err := bot.Request(config)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("User unban request error: %d in chat %d, error %s", userID, chatID, err))
+		return err
+	}
+	slog.Info(fmt.Sprintf("User unbanned: %d in chat %d", userID, chatID))
+	return nil
 }
 
-func isDenyBot(message *tgbotapi.Message) bool {
+// muteUser takes all rights for the duration, the scheduler gives back rights of the tier
+func muteUser(chatID int64, userID int64, duration time.Duration, adminID int64, reason string) {
+	until := time.Now().UTC().Add(duration)
+	config := tgbotapi.RestrictChatMemberConfig{
+		ChatMemberConfig: tgbotapi.ChatMemberConfig{
+			ChatConfig: tgbotapi.ChatConfig{
+				ChatID: chatID,
+			},
+			UserID: userID,
+		},
+		UntilDate:   until.Unix(),
+		Permissions: &tgbotapi.ChatPermissions{},
+	}
+	if _, err := bot.Request(config); err != nil {
+		slog.Warn(fmt.Sprintf("User mute request error: %d in chat %d, error %s", userID, chatID, err))
+		return
+	}
+	slog.Info(fmt.Sprintf("User muted: %d in chat %d until %d", userID, chatID, until.Unix()))
+	logModeration(ModerationEntry{Action: "mute", ChatID: chatID, UserID: userID, AdminID: adminID, Reason: reason, Until: until})
+	schedule(Job{Kind: JOB_LIFT_RESTRICTION, ChatID: chatID, UserID: userID, Due: until})
+}
+
+func isChannelMessage(message *tgbotapi.Message) bool {
+	return message.SenderChat != nil
+}
+
+func isDenyBot(chat ChatConfig, message *tgbotapi.Message) bool {
 	badbot := false
 	if message.ViaBot != nil {
-		for _, bot := range MainConfig.DenyBots {
+		for _, bot := range chat.DenyBots {
 			if strings.ToLower(message.ViaBot.UserName) == bot {
 				slog.Info("Message denied - Bad bot " + bot)
 				badbot = true
@@ -116,13 +174,21 @@ func isDenyBot(message *tgbotapi.Message) bool {
 	return badbot
 }
 
-func isDenyChat(message *tgbotapi.Message) bool {
+func isDenyChat(chat ChatConfig, message *tgbotapi.Message) bool {
 	badchat := false
-	if message.ForwardOrigin != nil && len(message.ForwardOrigin.Chat.UserName) > 0 {
-		for _, chat := range MainConfig.DenyChats {
-			if strings.ToLower(message.ForwardOrigin.Chat.UserName) == strings.ToLower(chat) {
+	// Chat is set for channels, SenderChat for anonymous group admins, users have neither
+	var origin *tgbotapi.Chat
+	if message.ForwardOrigin != nil {
+		origin = message.ForwardOrigin.Chat
+		if origin == nil {
+			origin = message.ForwardOrigin.SenderChat
+		}
+	}
+	if origin != nil && len(origin.UserName) > 0 {
+		for _, denyChat := range chat.DenyChats {
+			if strings.ToLower(origin.UserName) == strings.ToLower(denyChat) {
 				badchat = true
-				slog.Info("Message denied - Bad chat " + chat)
+				slog.Info("Message denied - Bad chat " + denyChat)
 				break
 			}
 		}
@@ -147,36 +213,18 @@ func getNameLink(user tgbotapi.User) string {
 }
 
 func deleteMessage(chatID int64, messageId int) {
-	_, err = bot.Request(tgbotapi.NewDeleteMessage(chatID, messageId))
+	_, err := bot.Request(tgbotapi.NewDeleteMessage(chatID, messageId))
 	if err != nil {
 		slog.Error(err.Error())
 	}
 }
 
 func deleteMessages(chatID int64, messageIds []int) {
-	_, err = bot.Request(tgbotapi.NewDeleteMessages(chatID, messageIds))
+	_, err := bot.Request(tgbotapi.NewDeleteMessages(chatID, messageIds))
 	if err != nil {
 		slog.Error(err.Error())
 	}
-	slog.Info(fmt.Sprintf("Deleting trigger %d messages from chat %d", len(messageIds), chatID))
-}
-
-func isBadMessage(message string) bool {
-	for _, word := range MainConfig.ForbiddenText {
-		if word[0] == 'r' {
-			regex := regexp.MustCompile(word[2:])
-			if regex.MatchString(message) {
-				slog.Info("TriggeredBad: ", "term", word[2:])
-				return true
-			}
-		} else {
-			if strings.Contains(message, word) {
-				slog.Info("TriggeredBad: ", "term", word)
-				return true
-			}
-		}
-	}
-	return false
+	slog.Info(fmt.Sprintf("Deleting %d messages from chat %d", len(messageIds), chatID))
 }
 
 func toggleDebugmode() string {
@@ -194,17 +242,18 @@ func toggleDebugmode() string {
 
 func toggleForcemode() string {
 	msg := ""
-	if forceProtection {
-		forceProtection = false
+	if forceProtection.Load() {
+		forceProtection.Store(false)
 		msg = "ForceProtection mode off"
 	} else {
-		forceProtection = true
+		forceProtection.Store(true)
 		msg = "ForceProtection mode on"
 	}
 	slog.Info(msg)
 	return msg
 }
 
+// isAdmin checks if user is bot admin, allowed to manage every chat and the ban list
 func isAdmin(userId int64) bool {
 	for _, admin := range MainConfig.Admins {
 		if int64(admin) == userId {
@@ -214,12 +263,35 @@ func isAdmin(userId int64) bool {
 	return false
 }
 
-func getPinnedMessage() string {
-	return MainConfig.PinnedMessage
+// adminChats lists managed chats where user is admin, bot admins get all of them
+func adminChats(userId int64) []int64 {
+	if isAdmin(userId) {
+		return managedChats()
+	}
+	var chats []int64
+	for _, chatID := range managedChats() {
+		if isChatAdmin(getChatConfig(chatID), userId) {
+			chats = append(chats, chatID)
+		}
+	}
+	return chats
+}
+
+func isChatAdmin(chat ChatConfig, userId int64) bool {
+	for _, admin := range chat.Admins {
+		if int64(admin) == userId {
+			return true
+		}
+	}
+	return false
+}
+
+func getPinnedMessage(chatID int64) string {
+	return getChatConfig(chatID).PinnedMessage
 }
 
-func getPinnedMessageId() int {
-	return MainConfig.PinnedMessageId
+func getPinnedMessageId(chatID int64) int {
+	return getChatConfig(chatID).PinnedMessageId
 }
 
 func unique[T comparable](arr []T) []T {
@@ -235,15 +307,3 @@ func unique[T comparable](arr []T) []T {
 
 	return uniqueArr
 }
-
-func isBadName(member *tgbotapi.ChatMemberUpdated) bool {
-	badName := false
-	for _, name := range MainConfig.DenyNames {
-		if strings.Contains(strings.ToLower(member.From.FirstName+" "+member.From.LastName+" "+member.From.UserName), name) {
-			slog.Info("BadName:" + member.From.FirstName + " " + member.From.LastName + " " + member.From.UserName)
-			badName = true
-			break
-		}
-	}
-	return badName
-}
@@ -0,0 +1,105 @@
+package main
+
+/*
+ - Chats with `join_requests` screen applicants before they see the chat.
+ - Name filters and ban providers decline or ban at once, others get the challenge in private chat.
+ - Right answer approves the request, wrong answer or timeout declines it.
+ - Approved users are not welcomed again, they get rights by ban policy and the reached tier.
+*/
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+
+	tgbotapi "github.com/OvyFlash/telegram-bot-api"
+)
+
+func processJoinRequest(chat ChatConfig, request *tgbotapi.ChatJoinRequest) {
+	if !chat.JoinRequests {
+		return
+	}
+	user := request.From
+	slog.Info(fmt.Sprintf("Join request from %s(%d) to chat %d", user.UserName, user.ID, request.Chat.ID))
+
+	if isBadUserName(chat, user) {
+		declineJoinRequest(request.Chat.ID, user.ID, "bad name")
+		banUser(request.Chat.ID, user.ID, 0, "bad name")
+		return
+	}
+	challenge := getChallenge(chat.Challenge)
+	switch userBanAction(chat, user.ID) {
+	case ACTION_BAN:
+		declineJoinRequest(request.Chat.ID, user.ID, "ban lists")
+		banUser(request.Chat.ID, user.ID, 0, "ban lists")
+		return
+	case ACTION_CAPTCHA, ACTION_RESTRICT_MEDIA:
+		challenge = getCaptchaChallenge(chat)
+	}
+	sendJoinChallenge(chat, request, challenge)
+}
+
+// sendJoinChallenge asks the question in private chat with the applicant
+func sendJoinChallenge(chat ChatConfig, request *tgbotapi.ChatJoinRequest, challenge Challenge) {
+	text, keyboard, answer := challenge.Question(chat, request.From)
+	msg := tgbotapi.NewMessage(request.UserChatID, text)
+	msg.LinkPreviewOptions.IsDisabled = true
+	msg.ParseMode = "HTML"
+	if keyboard != nil {
+		msg.ReplyMarkup = *keyboard
+	}
+
+	if emulate {
+		log.Println("Join " + challenge.Name() + " for " + request.From.UserName)
+		return
+	}
+	messageSent, err := bot.Send(msg)
+	if err != nil {
+		// Applicant can't be asked, admins decide
+		slog.Warn("Join challenge error:", "error", err)
+		return
+	}
+	welcome := welcomeSent(chat, messageSent, request.From.ID, challenge.Name(), answer)
+	welcome.JoinChat = request.Chat.ID
+	cache.UpdateWelcome(welcome)
+	scheduleChallenge(chat, welcome, request.From)
+}
+
+// approveJoinRequest checks the applicant of the answered welcome again, returns text for the user
+func approveJoinRequest(welcome WelcomeMessage) string {
+	chatID, userID := welcome.JoinChat, welcome.UserID
+	if userBanAction(getChatConfig(chatID), userID) == ACTION_BAN {
+		declineJoinRequest(chatID, userID, "ban lists")
+		banUser(chatID, userID, 0, "ban lists")
+		return "Sorry, Api Ban"
+	}
+	_, err := bot.Request(tgbotapi.ApproveChatJoinRequestConfig{
+		ChatConfig: tgbotapi.ChatConfig{ChatID: chatID},
+		UserID:     userID,
+	})
+	if err != nil {
+		slog.Warn(fmt.Sprintf("Approve join request error: %d in chat %d, error %s", userID, chatID, err))
+		return "Request is not found, try to join again"
+	}
+	slog.Info(fmt.Sprintf("Join request approved: %d in chat %d", userID, chatID))
+	cache.RemoveWelcomeByUser(userID, welcome.ChatID)
+	return "Request approved, welcome!"
+}
+
+func declineJoinRequest(chatID int64, userID int64, reason string) {
+	_, err := bot.Request(tgbotapi.DeclineChatJoinRequest{
+		ChatConfig: tgbotapi.ChatConfig{ChatID: chatID},
+		UserID:     userID,
+	})
+	if err != nil {
+		slog.Warn(fmt.Sprintf("Decline join request error: %d in chat %d, error %s", userID, chatID, err))
+		return
+	}
+	slog.Info(fmt.Sprintf("Join request declined: %d in chat %d", userID, chatID))
+	logModeration(ModerationEntry{Action: "decline", ChatID: chatID, UserID: userID, Reason: reason})
+}
+
+// isApprovedJoin is true for members who passed screening of join request
+func isApprovedJoin(chat ChatConfig, member *tgbotapi.ChatMemberUpdated) bool {
+	return chat.JoinRequests && member.ViaJoinRequest && member.NewChatMember.Status == "member"
+}
@@ -0,0 +1,156 @@
+package main
+
+/*
+ - Links are taken from url and text_link entities, buttons and plain text.
+ - `allow_domains` are never deleted, `deny_domains` are deleted for everyone but admins.
+ - `newcomer_links` deletes links of members joined less than this time ago.
+ - `deny_invites` deletes t.me invite links, `deny_shorteners` deletes links hiding their target.
+*/
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	tgbotapi "github.com/OvyFlash/telegram-bot-api"
+)
+
+// Links Telegram doesn't mark as entities, e.g. in edited or forwarded texts
+var linkPattern = regexp.MustCompile(`(?i)(?:https?|tg)://[^\s<>"]+|\b(?:t\.me|telegram\.me|telegram\.dog)/[^\s<>"]+`)
+
+var telegramHosts = []string{"t.me", "telegram.me", "telegram.dog"}
+
+var shorteners = []string{
+	"bit.ly", "bit.do", "buff.ly", "clck.ru", "cutt.ly", "goo.gl", "is.gd", "lnkd.in", "ow.ly",
+	"rb.gy", "rebrand.ly", "s.id", "shorturl.at", "t.co", "tiny.cc", "tinyurl.com", "v.gd",
+}
+
+// entityText cuts the entity out of the text, offsets are in UTF-16 units
+func entityText(text string, entity tgbotapi.MessageEntity) string {
+	units := utf16.Encode([]rune(text))
+	if entity.Offset < 0 || entity.Length < 0 || entity.Offset+entity.Length > len(units) {
+		return ""
+	}
+	return string(utf16.Decode(units[entity.Offset : entity.Offset+entity.Length]))
+}
+
+// messageLinks returns all links of the message, parsed
+func messageLinks(message *tgbotapi.Message) []*url.URL {
+	var links []string
+	for _, source := range []struct {
+		text     string
+		entities []tgbotapi.MessageEntity
+	}{{message.Text, message.Entities}, {message.Caption, message.CaptionEntities}} {
+		for _, entity := range source.entities {
+			switch entity.Type {
+			case "url":
+				links = append(links, entityText(source.text, entity))
+			case "text_link":
+				links = append(links, entity.URL)
+			}
+		}
+		links = append(links, linkPattern.FindAllString(source.text, -1)...)
+	}
+	if message.ReplyMarkup != nil {
+		for _, row := range message.ReplyMarkup.InlineKeyboard {
+			for _, button := range row {
+				if button.URL != nil {
+					links = append(links, *button.URL)
+				}
+			}
+		}
+	}
+
+	var parsed []*url.URL
+	for _, link := range links {
+		if u := parseLink(link); u != nil {
+			parsed = append(parsed, u)
+		}
+	}
+	return parsed
+}
+
+// parseLink accepts links without scheme, host is lowercased without www.
+func parseLink(link string) *url.URL {
+	link = strings.TrimRight(link, ".,;:!?)")
+	if !strings.Contains(link, "://") {
+		link = "http://" + link
+	}
+	u, err := url.Parse(link)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+	u.Host = strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	return u
+}
+
+// matchDomain is true for the domain and its subdomains
+func matchDomain(host string, domains []string) bool {
+	for _, domain := range domains {
+		domain = strings.TrimPrefix(strings.ToLower(domain), "www.")
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func isInviteLink(u *url.URL) bool {
+	if u.Scheme == "tg" {
+		return u.Host == "join"
+	}
+	for _, host := range telegramHosts {
+		if u.Host == host {
+			return strings.HasPrefix(u.Path, "/+") || strings.HasPrefix(u.Path, "/joinchat/")
+		}
+	}
+	return false
+}
+
+// isShortener matches exact hosts, maps.app.goo.gl is not a shortener
+func isShortener(host string) bool {
+	for _, shortener := range shorteners {
+		if host == shortener {
+			return true
+		}
+	}
+	return false
+}
+
+// isNewcomer is true for members joined less than `newcomer_links` ago
+func isNewcomer(chat ChatConfig, chatID int64, userID int64) bool {
+	if chat.NewcomerLinks <= 0 {
+		return false
+	}
+	stats := cache.GetStats(userID, chatID)
+	// Join was not seen, member is older than the bot
+	if stats == nil || stats.Joined.IsZero() {
+		return false
+	}
+	return time.Since(stats.Joined) < chat.NewcomerLinks
+}
+
+// checkLinks returns why the message breaks link policy of the chat, empty if it doesn't
+func checkLinks(chat ChatConfig, message *tgbotapi.Message) string {
+	if message.Chat.IsPrivate() {
+		return ""
+	}
+	newcomer := message.From != nil && isNewcomer(chat, message.Chat.ID, message.From.ID)
+	for _, link := range messageLinks(message) {
+		switch {
+		case matchDomain(link.Host, chat.AllowDomains):
+			continue
+		case matchDomain(link.Host, chat.DenyDomains):
+			return "denied domain " + link.Host
+		case newcomer:
+			return "newcomer link " + link.Host
+		case chat.DenyInvites && isInviteLink(link):
+			return "invite link " + link.String()
+		case chat.DenyShorteners && isShortener(link.Host):
+			return "shortener " + link.Host
+		}
+	}
+	return ""
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	tgbotapi "github.com/OvyFlash/telegram-bot-api"
+)
+
+func Test_messageLinks(t *testing.T) {
+	button := "https://button.example/x"
+	message := &tgbotapi.Message{
+		Text: "Привет 👋 example.com and https://WWW.Site.org/page, see t.me/+AbCd",
+		Entities: []tgbotapi.MessageEntity{
+			{Type: "url", Offset: 10, Length: 11},
+			{Type: "text_link", Offset: 0, Length: 6, URL: "https://hidden.example/"},
+		},
+		Caption:     "tg://join?invite=abc",
+		ReplyMarkup: &tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{{{Text: "go", URL: &button}}}},
+	}
+	var hosts []string
+	for _, link := range messageLinks(message) {
+		hosts = append(hosts, link.Host)
+	}
+	want := []string{"example.com", "hidden.example", "site.org", "t.me", "join", "button.example"}
+	if len(hosts) != len(want) {
+		t.Fatalf("messageLinks() hosts = %v, want %v", hosts, want)
+	}
+	for i := range want {
+		if hosts[i] != want[i] {
+			t.Errorf("messageLinks() hosts = %v, want %v", hosts, want)
+			break
+		}
+	}
+}
+
+func Test_checkLinks(t *testing.T) {
+	chat := ChatConfig{
+		AllowDomains:   []string{"github.com", "t.me"},
+		DenyDomains:    []string{"casino.example"},
+		DenyInvites:    true,
+		DenyShorteners: true,
+	}
+	tests := []struct {
+		name string
+		chat ChatConfig
+		text string
+		want bool
+	}{
+		{"Plain", chat, "https://golang.org", false},
+		{"Denied", chat, "https://casino.example/win", true},
+		{"DeniedSubdomain", chat, "http://www.vip.casino.example", true},
+		{"Allowed", chat, "https://gist.github.com/x", false},
+		{"Shortener", chat, "https://bit.ly/abc", true},
+		{"MapsNotShortener", chat, "https://maps.app.goo.gl/abc", false},
+		{"InviteAllowedHost", chat, "https://t.me/+AbCd", false},
+		{"Invite", ChatConfig{DenyInvites: true}, "t.me/joinchat/AbCd", true},
+		{"InviteTg", ChatConfig{DenyInvites: true}, "tg://join?invite=AbCd", true},
+		{"Channel", ChatConfig{DenyInvites: true}, "https://t.me/golang", false},
+		{"NoLinks", chat, "casino.example is bad", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := &tgbotapi.Message{Text: tt.text, Chat: tgbotapi.Chat{ID: testChatID, Type: "supergroup"}}
+			if got := checkLinks(tt.chat, message) != ""; got != tt.want {
+				t.Errorf("checkLinks(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_newcomerLinks(t *testing.T) {
+	fake := setupTestBot(t)
+	chat := MainConfig.Chats[testChatID]
+	chat.NewcomerLinks = 24 * time.Hour
+	chat.AllowDomains = []string{"github.com"}
+	MainConfig.Chats[testChatID] = chat
+
+	// Join was not seen
+	processUpdate(messageUpdate(testUser, "see https://example.com"))
+	if deletes := fake.methodCalls("deleteMessage"); len(deletes) != 0 {
+		t.Fatalf("deleteMessage calls = %v, want link of old member kept", deletes)
+	}
+
+	memberJoined(testChatID, testUser.ID)
+	processUpdate(messageUpdate(testUser, "see https://github.com/x"))
+	if deletes := fake.methodCalls("deleteMessage"); len(deletes) != 0 {
+		t.Fatalf("deleteMessage calls = %v, want allowed link kept", deletes)
+	}
+	processUpdate(messageUpdate(testUser, "see https://example.com"))
+	if deletes := fake.methodCalls("deleteMessage"); len(deletes) != 1 {
+		t.Fatalf("deleteMessage calls = %v, want newcomer link deleted", deletes)
+	}
+
+	stats := cache.GetStats(testUser.ID, testChatID)
+	stats.Joined = time.Now().UTC().Add(-25 * time.Hour)
+	cache.SetStats(*stats)
+	fake.reset()
+	processUpdate(messageUpdate(testUser, "see https://example.com"))
+	if deletes := fake.methodCalls("deleteMessage"); len(deletes) != 0 {
+		t.Fatalf("deleteMessage calls = %v, want link kept after newcomer time", deletes)
+	}
+}
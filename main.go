@@ -9,6 +9,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	tgbotapi "github.com/OvyFlash/telegram-bot-api"
@@ -16,25 +17,25 @@ import (
 )
 
 type Config struct {
-	Token                string            `yaml:"bot_token"`
-	Connection           string            `yaml:"connection"`
-	HostPort             string            `yaml:"hostport"`
-	ForbiddenText        []string          `yaml:"forbiddenText"`
-	Ranks                map[string]string `yaml:"ranks"`
-	WelcomeMessage       string            `yaml:"welcome_message"`
-	WelcomeButtonMessage string            `yaml:"welcome_button_message"`
-	DenyBots             []string          `yaml:"denybots"`
-	DenyChats            []string          `yaml:"denychats"`
-	DenyNames            []string          `yaml:"denynames"`
-	Admins               []int             `yaml:"admins"`
-	PinnedMessage        string            `yaml:"pinnedMessage"`
-	PinnedMessageId      int               `yaml:"pinnedMessageId"`
+	Token         string                       `yaml:"bot_token"`
+	Connection    string                       `yaml:"connection"`
+	HostPort      string                       `yaml:"hostport"`
+	ApiEndpoint   string                       `yaml:"api_endpoint"` //Bot API server, https://api.telegram.org/bot%s/%s by default
+	Storage       string                       `yaml:"storage"`      //json or sqlite
+	StoragePath   string                       `yaml:"storage_path"` //cache.json or cache.db by default
+	Workers       int                          `yaml:"workers"`      //Parallel update workers
+	QueueSize     int                          `yaml:"queue_size"`   //Pending updates per worker
+	BanProviders  map[string]BanProviderConfig `yaml:"ban_providers"`
+	ModerationLog string                       `yaml:"moderation_log"` //moderation.jsonl by default
+	ChatID        int64                        `yaml:"chat_id"`        //The only chat when there is no `chats:` section
+	ChatConfig    `yaml:",inline"`             //Defaults for all chats
+	Chats         map[int64]ChatConfig         `yaml:"-"` //Filled from `chats:` section
 }
 
 const TEXTMESSAGE_LIMIT = 4096
 
 var emulate = false
-var forceProtection = true
+var forceProtection atomic.Bool
 
 var MainConfig Config
 var startTime time.Time
@@ -42,156 +43,201 @@ var bot *tgbotapi.BotAPI
 var err error
 
 func init() {
+	forceProtection.Store(true)
+}
+
+func main() {
+	var updates tgbotapi.UpdatesChannel
 	readConfig() //Fill config with values
 	readTriggers()
 	importCache()
 	startTime = time.Now()
 	go syncData()
-}
 
-func main() {
-	var updates tgbotapi.UpdatesChannel
 	botInit()
 	afterBotInit()
 	go initMetrics()
+	startScheduler()
 	updates = startBot()
 	processUpdates(updates)
 
 } //End main()
 
-func processUpdates(updates tgbotapi.UpdatesChannel) {
-	for update := range updates {
-		requestsTotal.Inc()
-		// Check for callback query
-		if update.CallbackQuery != nil {
-			handleCallback(update.CallbackQuery)
-			continue
-		}
+func processUpdate(update tgbotapi.Update) {
+	chat := getUpdateChatConfig(update)
+	rememberUpdateUsers(update)
+	// Check for callback query
+	if update.CallbackQuery != nil {
+		handleCallback(update.CallbackQuery)
+		return
+	}
 
-		//Private chat
-		if update.MyChatMember != nil {
-			slog.Info(fmt.Sprintf("New MyChatMember %d", update.MyChatMember.NewChatMember.User.ID))
+	//Private chat
+	if update.MyChatMember != nil {
+		slog.Info(fmt.Sprintf("New MyChatMember %d", update.MyChatMember.NewChatMember.User.ID))
+	}
+	if update.ChatJoinRequest != nil {
+		processJoinRequest(chat, update.ChatJoinRequest)
+		return
+	}
+	//If chat hides userlist
+	if update.ChatMember != nil {
+		if update.ChatMember.NewChatMember.Status == "kicked" {
+			rememberKicked(update.ChatMember)
+			return
 		}
-		//If chat hides userlist
-		if update.ChatMember != nil {
-			if update.ChatMember.NewChatMember.Status == "kicked" {
-				continue
-			}
-			if update.ChatMember.NewChatMember.Status == "left" {
-				continue
-			}
-			if update.ChatMember.NewChatMember.Status == "restricted" {
-				continue
-			}
-
-			if isBadName(update.ChatMember) {
-				BanChatMember(update.ChatMember.Chat.ID, update.ChatMember.NewChatMember.User.ID, 0)
-				continue
-			}
-
-			if isNewMember(update.ChatMember) {
-				setInitialRights(update, *update.ChatMember.NewChatMember.User)
-				if forceProtection {
-					if isUserApiBanned(int(update.ChatMember.NewChatMember.User.ID)) {
-						BanChatMember(update.ChatMember.Chat.ID, update.ChatMember.NewChatMember.User.ID, 0)
-					} else {
-						welcomeNewUser(update, *update.ChatMember.NewChatMember.User)
-					}
-				} else {
-					welcomeNewUser(update, *update.ChatMember.NewChatMember.User)
-				}
-			}
+		if update.ChatMember.NewChatMember.Status == "left" {
+			return
+		}
+		if update.ChatMember.NewChatMember.Status == "restricted" {
+			return
 		}
 
-		if update.Message == nil { // ignore any non-Message updates
-			if update.EditedMessage != nil {
-				CheckTriggerMessage(update.EditedMessage)
-			}
-			continue
+		if isBadName(chat, update.ChatMember) {
+			banUser(update.ChatMember.Chat.ID, update.ChatMember.NewChatMember.User.ID, 0, "bad name")
+			return
 		}
 
-		if update.Message.IsCommand() { // ignore any non-command Messages
-			processCommands(update.Message.Command(), *update.Message)
-			continue
+		if isApprovedJoin(chat, update.ChatMember) {
+			memberJoined(update.ChatMember.Chat.ID, update.ChatMember.NewChatMember.User.ID)
+			grantUserRights(update.ChatMember.Chat.ID, update.ChatMember.NewChatMember.User.ID)
+			return
 		}
 
-		// Handle new members joining
-		if update.Message.NewChatMembers != nil {
-			//Clean old triggers
-			cleanTriggers()
-			//Check members
-			for _, newMember := range update.Message.NewChatMembers {
-				if isCachedUser(newMember.ID, update.FromChat().ID) {
-					welcomeNewUser(update, newMember)
-					setInitialRights(update, newMember)
-					checkCachedQueue()
-					continue
+		if isNewMember(update.ChatMember) {
+			setInitialRights(update, *update.ChatMember.NewChatMember.User)
+			if forceProtection.Load() {
+				switch userBanAction(chat, update.ChatMember.NewChatMember.User.ID) {
+				case ACTION_BAN:
+					banUser(update.ChatMember.Chat.ID, update.ChatMember.NewChatMember.User.ID, 0, "ban lists")
+				case ACTION_CAPTCHA, ACTION_RESTRICT_MEDIA:
+					welcomeWithChallenge(chat, update, *update.ChatMember.NewChatMember.User, getCaptchaChallenge(chat))
+				default:
+					welcomeNewUser(chat, update, *update.ChatMember.NewChatMember.User)
 				}
+			} else {
+				welcomeNewUser(chat, update, *update.ChatMember.NewChatMember.User)
 			}
 		}
+	}
 
-		//Handle member left
-		if update.Message.LeftChatMember != nil {
-			slog.Info("Member left: " + update.Message.LeftChatMember.UserName)
-			slog.Info("Update.Message" + update.Message.Text)
-			//log.Print(fmt.Printf("%+v\n", update.Message))
-			continue
+	if update.Message == nil { // ignore any non-Message updates
+		// Spam is edited in after the check
+		if update.EditedMessage != nil && !filterMessage(chat, update.EditedMessage) {
+			CheckTriggerMessage(chat, update.EditedMessage)
 		}
+		return
+	}
 
-		if isDenyBot(update.Message) {
-			deleteMessage(update.Message.Chat.ID, update.Message.MessageID)
-			continue
-		}
+	if update.Message.IsCommand() { // ignore any non-command Messages
+		processCommands(update.Message.Command(), *update.Message)
+		return
+	}
 
-		if isDenyChat(update.Message) {
+	// Typed challenge answer
+	if checkTypedAnswer(update.Message) {
+		return
+	}
+
+	// Handle new members joining
+	if update.Message.NewChatMembers != nil {
+		if chat.DeleteJoinMessage {
 			deleteMessage(update.Message.Chat.ID, update.Message.MessageID)
-			continue
 		}
-
-		// Check for forbidden text
-		if !isAdmin(update.Message.From.ID) {
-			// Check Bad text message
-			if isBadMessage(update.Message.Text) {
-				if emulate {
-					log.Print(update.Message.Chat.ID, update.Message.MessageID)
-					continue
-				}
-				deleteMessage(update.Message.Chat.ID, update.Message.MessageID)
-				CleanUpWelcome()
-				//CleanWelcomeQueue()
+		//Check members
+		for _, newMember := range update.Message.NewChatMembers {
+			if isCachedUser(newMember.ID, update.FromChat().ID) {
+				setInitialRights(update, newMember)
+				welcomeNewUser(chat, update, newMember)
+				checkCachedQueue()
 				continue
 			}
-			//Check message starting with emoji. Usually spam.
-			if isMessageStartsWithEmoji(update) {
-				slog.Info("Deleted message with emoji - " + update.Message.From.UserName)
-				deleteMessage(update.Message.Chat.ID, update.Message.MessageID)
-			}
-			//Check message from channel
-			if isChannelMessage(update) {
-				slog.Info("Deleted message from channel - " + update.Message.SenderChat.UserName)
-				deleteMessage(update.Message.Chat.ID, update.Message.MessageID)
-				continue
-			}
-		} else {
-			//AdminsZone
-			if update.Message.ChatShared != nil {
-				if update.Message.ChatShared.RequestID == 1000 { //pin message
-					pinMessage(update.Message.ChatShared.ChatID)
-				}
+		}
+		// Service message is not a message of the member
+		return
+	}
+
+	//Handle member left
+	if update.Message.LeftChatMember != nil {
+		slog.Info("Member left: " + update.Message.LeftChatMember.UserName)
+		slog.Info("Update.Message" + update.Message.Text)
+		//log.Print(fmt.Printf("%+v\n", update.Message))
+		return
+	}
+
+	if filterMessage(chat, update.Message) {
+		return
+	}
+
+	if isChatAdmin(chat, update.Message.From.ID) {
+		//AdminsZone
+		if update.Message.ChatShared != nil {
+			if update.Message.ChatShared.RequestID == 1000 { //pin message
+				pinMessage(update.Message.ChatShared.ChatID)
 			}
 		}
+	}
 
-		CheckTriggerMessage(update.Message)
+	CheckTriggerMessage(chat, update.Message)
 
-		//Fix rights for the newcomers
-		fixRights(update)
+	collectMapUrls(*update.Message)
+
+	//Deleted messages returned earlier and are not counted
+	countMessage(chat, update.Message)
+	//Newcomers get more rights with messages and time
+	applyRightsTier(chat, update.Message.Chat.ID, update.Message.From.ID)
+}
 
-		collectMapUrls(*update.Message)
+// filterMessage deletes spam and punishes the sender, true if the message is deleted
+func filterMessage(chat ChatConfig, message *tgbotapi.Message) bool {
+	if isDenyBot(chat, message) {
+		removeMessage(message, 0, "denied bot")
+		return true
 	}
+	if isDenyChat(chat, message) {
+		removeMessage(message, 0, "denied chat")
+		return true
+	}
+	if message.From == nil || isChatAdmin(chat, message.From.ID) {
+		return false
+	}
+	// Name is checked again, members rename after join
+	if !message.Chat.IsPrivate() && message.SenderChat == nil && isBadUserName(chat, *message.From) {
+		removeMessage(message, 0, "bad name")
+		banUser(message.Chat.ID, message.From.ID, 0, "bad name")
+		return true
+	}
+	// Check forbidden text in all texts of the message
+	if rule := findMessageRule(chat, message); rule != nil {
+		if emulate {
+			log.Print(message.Chat.ID, message.MessageID)
+			return true
+		}
+		applyRuleAction(rule, message)
+		return true
+	}
+	if reason := checkLinks(chat, message); reason != "" {
+		removeMessage(message, 0, reason)
+		return true
+	}
+	if checkFlood(chat, message) {
+		return true
+	}
+	//Check message starting with emoji. Usually spam.
+	if isMessageStartsWithEmoji(message) {
+		removeMessage(message, 0, "starts with emoji")
+		return true
+	}
+	//Check message from channel
+	if isChannelMessage(message) {
+		removeMessage(message, 0, "message from channel "+message.SenderChat.UserName)
+		return true
+	}
+	return false
 }
 
 func pinMessage(id int64) {
-	msg := tgbotapi.NewMessage(id, getPinnedMessage())
+	msg := tgbotapi.NewMessage(id, getPinnedMessage(id))
 	msg.ParseMode = "HTML"
 	mId, _ := bot.Send(msg)
 	slog.Info(fmt.Sprintf("Pinned message ID: %d", mId.MessageID))
@@ -211,22 +257,37 @@ func handleCallback(query *tgbotapi.CallbackQuery) {
 	switch callback.Command {
 	case "upgrade_rights":
 		user, err = strconv.ParseInt(callback.Data, 10, 64)
-		if !isAdmin(query.From.ID) {
+		if !isChatAdmin(getChatConfig(query.Message.Chat.ID), query.From.ID) {
 			if user != query.From.ID {
 				slog.Info(fmt.Sprintf("User %s(%d) clicked wrong button", query.From.UserName, query.From.ID))
 				break
 			}
 		}
 		slog.Info(fmt.Sprintf("User %s(%d) clicked his button", query.From.UserName, query.From.ID))
-		if isUserApiBanned(int(user)) {
-			answerCallbackQuery(query.ID, "Sorry, Api Ban")
-			BanChatMember(query.Message.Chat.ID, user, 0)
+		if welcome := cache.GetWelcome(query.Message.Chat.ID, query.Message.MessageID); welcome != nil && welcome.JoinChat != 0 {
+			// Button of join request is in private chat, the request is approved instead
+			answerCallbackQuery(query.ID, approveJoinRequest(*welcome))
 		} else {
-			upgradeUserRights(query.Message.Chat.ID, user)
-			answerCallbackQuery(query.ID, "Rights upgraded!")
+			answerCallbackQuery(query.ID, grantUserRights(query.Message.Chat.ID, user))
 		}
 		deleteMessage(query.Message.Chat.ID, query.Message.MessageID)
+	case "answer":
+		answer := strings.SplitN(callback.Data, ":", 2)
+		user, err = strconv.ParseInt(answer[0], 10, 64)
+		if user != query.From.ID || len(answer) != 2 {
+			slog.Info(fmt.Sprintf("User %s(%d) answered wrong question", query.From.UserName, query.From.ID))
+			break
+		}
+		welcome := cache.GetWelcome(query.Message.Chat.ID, query.Message.MessageID)
+		if welcome == nil || welcome.UserID != user {
+			slog.Info(fmt.Sprintf("User %s(%d) answered expired question", query.From.UserName, query.From.ID))
+			deleteMessage(query.Message.Chat.ID, query.Message.MessageID)
+			break
+		}
+		answerCallbackQuery(query.ID, solveChallenge(*welcome, answer[1]))
 	// handle other callbacks here
+	case UNDO_UNBAN, UNDO_UNMUTE, UNDO_RESTORE:
+		answerCallbackQuery(query.ID, undoModeration(query, callback.Command, callback.Data))
 	case "show_menu":
 		deleteMessage(query.Message.Chat.ID, query.Message.MessageID)
 		msg := tgbotapi.NewMessage(query.Message.Chat.ID, "ᓚᘏᗢ"+strings.Repeat(" ", 80)+"\\^o^/")
@@ -242,31 +303,10 @@ func handleCallback(query *tgbotapi.CallbackQuery) {
 	}
 }
 
-func fixRights(update tgbotapi.Update) {
-	config := tgbotapi.GetChatMemberConfig{
-		ChatConfigWithUser: tgbotapi.ChatConfigWithUser{
-			ChatConfig: tgbotapi.ChatConfig{
-				ChatID: update.Message.Chat.ID,
-			},
-			UserID: update.Message.From.ID,
-		},
-	}
-
-	member, err := bot.GetChatMember(config)
-	if err != nil {
-		log.Print(err)
-	}
-
-	if member.CanSendMessages && !member.CanAddWebPagePreviews {
-		slog.Info("Fix rights for user " + update.Message.From.UserName)
-		upgradeUserRights(update.Message.Chat.ID, update.Message.From.ID)
-	}
-}
-
 func processCommands(command string, message tgbotapi.Message) {
 	//Only Private messages
 	if message.From.ID != message.Chat.ID {
-		deleteMessage(message.Chat.ID, message.MessageID)
+		processGroupCommands(command, message)
 		return
 	}
 	msg := tgbotapi.NewMessage(message.Chat.ID, "")
@@ -275,8 +315,16 @@ func processCommands(command string, message tgbotapi.Message) {
 		msg.Text = "I understand /uptime and /start."
 		msg.ReplyParameters.MessageID = message.MessageID
 	case "unban":
-		if isAdmin(message.From.ID) {
-			//TODO as it's hard to get userId
+		if len(adminChats(message.From.ID)) > 0 {
+			msg.Text = unbanCommand(message)
+			msg.ReplyParameters.MessageID = message.MessageID
+		}
+	case "rank", "top", "warn", "ban", "kick", "mute", "ro", "del", "purge":
+		msg.Text = "Use /" + command + " in the chat"
+	case "warns":
+		if len(adminChats(message.From.ID)) > 0 {
+			msg.ParseMode = "HTML"
+			msg.Text = warnsCommand(message)
 		}
 	case "uptime":
 		msg.Text = "Uptime: " + uptime()
@@ -290,10 +338,10 @@ func processCommands(command string, message tgbotapi.Message) {
 		msg.Text = "Reloaded"
 	case "triggers":
 		msg.ParseMode = "HTML"
-		msg.Text = getTriggersList()
+		msg.Text = getTriggersList(message.Chat.ID)
 	case "clean_triggers":
-		counter := cleanTriggers()
-		msg.Text = "Cleaned " + strconv.Itoa(counter) + " trigger messages"
+		counter := scheduler.runDue(time.Now().UTC())
+		msg.Text = "Ran " + strconv.Itoa(counter) + " due jobs"
 	case "clean_welcome":
 		counter := checkCachedQueue()
 		msg.Text = "Cleaned " + strconv.Itoa(counter) + " welcomed users"
@@ -311,6 +359,10 @@ func processCommands(command string, message tgbotapi.Message) {
 	case "cleanup":
 		counter := CleanUpWelcome()
 		msg.Text = "Cleaned " + strconv.Itoa(counter) + " messages"
+	case "banlist", "banlist_add", "banlist_remove", "banlist_export", "banlist_import":
+		if isAdmin(message.From.ID) {
+			msg.Text = banlistCommand(command, message)
+		}
 	case "debug_mode":
 		msg.Text = toggleDebugmode()
 	case "force_mode":
@@ -318,21 +370,68 @@ func processCommands(command string, message tgbotapi.Message) {
 	default:
 		msg.Text = ""
 	}
-	if msg.Text != "" {
-		if len(msg.Text) < TEXTMESSAGE_LIMIT {
-			_, err = bot.Send(msg)
-			if err != nil {
-				log.Println(err)
-			}
+	sendText(msg)
+}
+
+// sendText splits long text by paragraphs, returns sent messages
+func sendText(msg tgbotapi.MessageConfig) []tgbotapi.Message {
+	var sent []tgbotapi.Message
+	if msg.Text == "" {
+		return sent
+	}
+	if len(msg.Text) < TEXTMESSAGE_LIMIT {
+		message, err := bot.Send(msg)
+		if err != nil {
+			log.Println(err)
+			return sent
+		}
+		return append(sent, message)
+	}
+	messages := strings.Split(msg.Text, "\r\n\r\n")
+	for _, message := range messages {
+		partialMessage := msg
+		partialMessage.Text = message
+		if message, err := bot.Send(partialMessage); err == nil {
+			sent = append(sent, message)
+		}
+	}
+	return sent
+}
+
+// processGroupCommands answers public commands, bot replies are deleted later like triggers.
+// Other commands are removed.
+func processGroupCommands(command string, message tgbotapi.Message) {
+	msg := tgbotapi.NewMessage(message.Chat.ID, "")
+	switch command {
+	case "rank":
+		msg.Text = rankCommand(getChatConfig(message.Chat.ID), message)
+	case "top":
+		msg.Text = topCommand(getChatConfig(message.Chat.ID), message)
+	case "ban", "kick", "mute", "ro", "del", "purge":
+		moderationCommand(getChatConfig(message.Chat.ID), command, message)
+		return
+	case "warn", "warns":
+		chat := getChatConfig(message.Chat.ID)
+		if !isChatAdmin(chat, message.From.ID) {
+			deleteMessage(message.Chat.ID, message.MessageID)
+			return
+		}
+		if command == "warn" {
+			msg.Text = warnCommand(chat, message)
 		} else {
-			messages := strings.Split(msg.Text, "\r\n\r\n")
-			for _, message := range messages {
-				partialMessage := msg
-				partialMessage.Text = message
-				_, err = bot.Send(partialMessage)
-			}
+			msg.Text = warnsCommand(message)
 		}
+	default:
+		deleteMessage(message.Chat.ID, message.MessageID)
+		return
+	}
+	msg.ParseMode = "HTML"
+	msg.LinkPreviewOptions.IsDisabled = true
+	msg.ReplyParameters.MessageID = message.MessageID
+	for _, sent := range sendText(msg) {
+		delayDeleteTrigger(sent, message.From.ID)
 	}
+	delayDeleteTrigger(message, message.From.ID)
 }
 
 func say() tgbotapi.ReplyKeyboardMarkup {
@@ -348,17 +447,16 @@ func say() tgbotapi.ReplyKeyboardMarkup {
 }
 
 func ToDeleteQueue() string {
-	return fmt.Sprintln(cache.DeleteList)
+	return fmt.Sprintln(cache.WelcomeQueue())
 }
 
 func checkBanQueue() int {
 	counter := 0
-	if len(cache.DeleteList) > 0 {
-		for id := 0; id < len(cache.DeleteList); id++ {
-			if isUserApiBanned(int(cache.DeleteList[id].UserID)) {
-				cache.DeleteList[id].Timestamp = time.Now().UTC()
-				counter++
-			}
+	for _, welcome := range cache.WelcomeQueue() {
+		if isUserApiBanned(int(welcome.UserID)) {
+			welcome.Timestamp = time.Now().UTC()
+			cache.UpdateWelcome(welcome)
+			counter++
 		}
 	}
 	CleanUpWelcome()
@@ -367,17 +465,24 @@ func checkBanQueue() int {
 
 func checkCachedQueue() int {
 	counter := 0
-	if len(cache.Member) > 0 {
-		for id := 0; id < min(20, len(cache.Member)); id++ {
-			if isUserApiBanned(int(cache.Member[id].Id)) {
-				if cache.Member[id].ChatId == 0 {
-					cache.Member[id].ChatId = -1001164690983
-				}
-				BanChatMember(cache.Member[id].ChatId, cache.Member[id].Id, time.Now().Unix()+10)
-				unbanChatMember(cache.Member[id].ChatId, cache.Member[id].Id)
-				cache.Member = append(cache.Member[:id], cache.Member[id+1:]...)
-				counter++
+	members := cache.Members()
+	for _, member := range members[:min(20, len(members))] {
+		if isUserApiBanned(int(member.Id)) {
+			chats := []int64{member.ChatId}
+			//Old cache entries have no chat, kick from all chats
+			if member.ChatId == 0 {
+				chats = managedChats()
+			}
+			if len(chats) == 0 {
+				slog.Warn(fmt.Sprintf("No chat to kick user %d from, set chat_id or chats in config.yaml", member.Id))
+				continue
 			}
+			for _, chatId := range chats {
+				BanChatMember(chatId, member.Id, time.Now().Unix()+10)
+				unbanChatMember(chatId, member.Id)
+			}
+			cache.RemoveMember(member.Id, member.ChatId)
+			counter++
 		}
 	}
 	return counter
@@ -403,6 +508,42 @@ func readConfig() {
 	if err != nil {
 		log.Panic(err)
 	}
+	err = readChats(configFile)
+	if err != nil {
+		log.Panic(err)
+	}
+	err = readBanProviders()
+	if err != nil {
+		log.Panic(err)
+	}
+	err = readRanks()
+	if err != nil {
+		log.Panic(err)
+	}
+	err = readRightsTiers()
+	if err != nil {
+		log.Panic(err)
+	}
+	err = readChallenges()
+	if err != nil {
+		log.Panic(err)
+	}
+	err = readDenyNames()
+	if err != nil {
+		log.Panic(err)
+	}
+	err = readForbiddenText()
+	if err != nil {
+		log.Panic(err)
+	}
+	err = readFloodPolicy()
+	if err != nil {
+		log.Panic(err)
+	}
+	err = readEscalation()
+	if err != nil {
+		log.Panic(err)
+	}
 	//Override with ENV
 	token := os.Getenv("BOT_TOKEN")
 	if token != "" {
@@ -416,7 +557,7 @@ func readConfig() {
 
 func botInit() {
 	//Common part
-	bot, err = tgbotapi.NewBotAPI(MainConfig.Token) // Set up the Telegram bot
+	bot, err = tgbotapi.NewBotAPIWithAPIEndpoint(MainConfig.Token, getApiEndpoint()) // Set up the Telegram bot
 	if err != nil {
 		log.Panic(err)
 	}
@@ -425,18 +566,10 @@ func botInit() {
 	}
 
 	slog.Info(fmt.Sprintf("Authorized on account %s", bot.Self.UserName))
-	admins, _ := bot.GetChatAdministrators(tgbotapi.ChatAdministratorsConfig{ChatConfig: tgbotapi.ChatConfig{
-		ChannelUsername: "@wrenjapanchat", //TODO Move to .env
-	}})
+	discoverAdmins()
 
-	for _, admin := range admins {
-		MainConfig.Admins = append(MainConfig.Admins, int(admin.User.ID))
-	}
 	MainConfig.Admins = unique(MainConfig.Admins)
-
 	slog.Info(fmt.Sprintf("Admins: %v", MainConfig.Admins))
-
-	//
 }
 
 func afterBotInit() {
@@ -3,6 +3,7 @@ package main
 import (
 	"log"
 	"os"
+	"sync"
 
 	tgbotapi "github.com/OvyFlash/telegram-bot-api"
 	"gopkg.in/yaml.v3"
@@ -18,6 +19,7 @@ type Menu struct {
 
 var menu []Menu
 var flatMenu map[string]Menu
+var menuMutex sync.RWMutex
 
 func startMenu() {
 	readMenu()
@@ -28,16 +30,20 @@ func startMenu() {
 
 func readMenu() {
 	// Parse menu.yaml
+	var newMenu []Menu
 	data, err := os.ReadFile("menu.yaml")
 	if err != nil {
 		log.Fatal(err)
 	}
-	err = yaml.Unmarshal(data, &menu)
+	err = yaml.Unmarshal(data, &newMenu)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	flatMenu = flattenMenu(menu)
+	menuMutex.Lock()
+	menu = newMenu
+	flatMenu = flattenMenu(newMenu)
+	menuMutex.Unlock()
 }
 
 func flattenMenu(menu []Menu) map[string]Menu {
@@ -97,6 +103,8 @@ func registerCommandHandlers() {
 }
 
 func rootMenu() tgbotapi.InlineKeyboardMarkup {
+	menuMutex.RLock()
+	defer menuMutex.RUnlock()
 	return generateMenuKeyboard(menu, false)
 }
 
@@ -106,6 +114,8 @@ func prepareCallbackMenuCommand(command string) string {
 
 // Used only for submenu
 func replyWithMenu(item string) tgbotapi.InlineKeyboardMarkup {
+	menuMutex.RLock()
+	defer menuMutex.RUnlock()
 	for key, value := range flatMenu {
 		if key == "."+item {
 			if value.Flatmenu != nil {
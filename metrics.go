@@ -49,6 +49,13 @@ var (
 		},
 		[]string{"service", "status"},
 	)
+	apiCacheTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "jpbot_api_cache_total",
+			Help: "Total number of cached external API verdict lookups",
+		},
+		[]string{"service", "status"},
+	)
 	apiRequestDuration = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "jpbot_api_request_duration_seconds",
@@ -91,7 +98,9 @@ func recordTriggerUsage(trigger string, private string) {
 
 func initMetrics() {
 	prometheus.MustRegister(triggerUsage)
+	prometheus.MustRegister(apiUsage)
 	prometheus.MustRegister(apiRequestsTotal)
+	prometheus.MustRegister(apiCacheTotal)
 	prometheus.MustRegister(apiRequestDuration)
 	prometheus.MustRegister(tgRequestsTotal)
 	// Register the metrics handler
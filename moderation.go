@@ -0,0 +1,163 @@
+package main
+
+/*
+ - Chat admins moderate in place by replying to a message:
+   /ban reason, /kick, /mute 2h, /ro [duration], /del, /purge (replied message and everything after it).
+ - The command is deleted at once, the answer is deleted after a minute.
+ - Commands of non-admins are silently deleted.
+ - Durations: 30m, 2h, 1d, 1w, from 30s to 366d. /mute is 1h by default, /ro is forever.
+*/
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/OvyFlash/telegram-bot-api"
+)
+
+// Answers of moderation commands are deleted after
+const COMMAND_REPLY_TTL = time.Minute
+
+// Messages deleted by one /purge
+const PURGE_LIMIT = 1000
+
+// Telegram restricts forever for shorter or longer durations
+const MIN_RESTRICT_DURATION = 30 * time.Second
+const MAX_RESTRICT_DURATION = 366 * 24 * time.Hour
+
+// parseDuration understands days and weeks besides time.ParseDuration units
+func parseDuration(text string) (time.Duration, error) {
+	duration, err := parseDurationUnits(text)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("wrong duration: %s", text)
+	}
+	if duration < MIN_RESTRICT_DURATION || duration > MAX_RESTRICT_DURATION {
+		return 0, fmt.Errorf("duration must be from 30s to 366d: %s", text)
+	}
+	return duration, nil
+}
+
+func parseDurationUnits(text string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if number, ok := strings.CutSuffix(text, suffix); ok {
+			count, err := strconv.Atoi(number)
+			// Huge counts would overflow into the range
+			count = min(count, int(MAX_RESTRICT_DURATION/unit)+1)
+			return time.Duration(count) * unit, err
+		}
+	}
+	return time.ParseDuration(text)
+}
+
+// moderationCommand deletes the command and runs it for admins
+func moderationCommand(chat ChatConfig, command string, message tgbotapi.Message) {
+	deleteMessage(message.Chat.ID, message.MessageID)
+	if !isChatAdmin(chat, message.From.ID) {
+		return
+	}
+	text := runModerationCommand(chat, command, message)
+	if text == "" {
+		return
+	}
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	msg.ParseMode = "HTML"
+	for _, sent := range sendText(msg) {
+		schedule(Job{Kind: JOB_DELETE_MESSAGE, ChatID: sent.Chat.ID, MessageID: sent.MessageID, Due: time.Now().UTC().Add(COMMAND_REPLY_TTL)})
+	}
+}
+
+// runModerationCommand returns the answer for the chat, empty if nothing to say
+func runModerationCommand(chat ChatConfig, command string, message tgbotapi.Message) string {
+	target := message.ReplyToMessage
+	if target == nil {
+		return "Reply /" + command + " to a message"
+	}
+	chatID := message.Chat.ID
+	switch command {
+	case "del":
+		removeMessage(target, message.From.ID, "deleted by admin")
+		return ""
+	case "purge":
+		counter := purgeMessages(chatID, target.MessageID, message.MessageID)
+		logModeration(ModerationEntry{Action: "purge", ChatID: chatID, AdminID: message.From.ID, Reason: fmt.Sprintf("%d messages", counter)})
+		return ""
+	}
+
+	if target.From == nil || target.SenderChat != nil {
+		return "Reply /" + command + " to a message of the user"
+	}
+	user := *target.From
+	if user.IsBot || isChatAdmin(chat, user.ID) {
+		return "Admins and bots are not touched"
+	}
+	adminID := message.From.ID
+	args := strings.Fields(message.CommandArguments())
+	var result string
+	switch command {
+	case "ban":
+		reason := strings.Join(args, " ")
+		if reason == "" {
+			reason = "banned by admin"
+		}
+		banUser(chatID, user.ID, adminID, reason)
+		result = "banned"
+	case "kick":
+		kickUser(chatID, user.ID, adminID, strings.Join(args, " "))
+		result = "kicked"
+	case "mute", "ro":
+		duration := time.Duration(0)
+		if command == "mute" {
+			duration = DEFAULT_MUTE_DURATION
+		}
+		if len(args) > 0 {
+			var err error
+			if duration, err = parseDuration(args[0]); err != nil {
+				return html.EscapeString(err.Error())
+			}
+		}
+		if duration == 0 {
+			restrictChatMember(chatID, user.ID, tgbotapi.ChatPermissions{}, true)
+			logModeration(ModerationEntry{Action: "ro", ChatID: chatID, UserID: user.ID, AdminID: adminID})
+			result = "is read-only"
+			break
+		}
+		muteUser(chatID, user.ID, duration, adminID, "/"+command)
+		result = "muted for " + formatDuration(duration)
+		if command == "ro" {
+			result = "is read-only for " + formatDuration(duration)
+		}
+	}
+	return getNameLink(user) + " " + result
+}
+
+// purgeMessages deletes messages from first to last, returns how many were asked to delete
+func purgeMessages(chatID int64, first int, last int) int {
+	first = max(first, last-PURGE_LIMIT+1)
+	var ids []int
+	for id := first; id <= last; id++ {
+		ids = append(ids, id)
+		// deleteMessages takes up to 100 messages
+		if len(ids) == 100 {
+			deleteMessages(chatID, ids)
+			ids = nil
+		}
+	}
+	if len(ids) > 0 {
+		deleteMessages(chatID, ids)
+	}
+	return last - first + 1
+}
+
+// senderID is the user or the chat which sent the message
+func senderID(message *tgbotapi.Message) int64 {
+	if message.SenderChat != nil {
+		return message.SenderChat.ID
+	}
+	if message.From != nil {
+		return message.From.ID
+	}
+	return 0
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/OvyFlash/telegram-bot-api"
+)
+
+func Test_parseDuration(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"2h", 2 * time.Hour, false},
+		{"30m", 30 * time.Minute, false},
+		{"1d", 24 * time.Hour, false},
+		{"2w", 14 * 24 * time.Hour, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"0d", 0, true},
+		{"30s", 30 * time.Second, false},
+		{"29s", 0, true},
+		{"10s", 0, true},
+		{"366d", 366 * 24 * time.Hour, false},
+		{"367d", 0, true},
+		{"53w", 0, true},
+		{"99999999999999w", 0, true},
+		{"-1h", 0, true},
+		{"soon", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseDuration(tt.text)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseDuration(%q) = %v, %v, want %v, error %v", tt.text, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// groupCommand is a reply of the user to a message of the target in the test chat
+func groupCommand(user tgbotapi.User, target tgbotapi.User, text string) tgbotapi.Update {
+	update := commandUpdate(user, text)
+	update.Message.Chat = tgbotapi.Chat{ID: testChatID, Type: "supergroup"}
+	update.Message.ReplyToMessage = messageUpdate(target, "spam").Message
+	return update
+}
+
+func Test_moderationCommands(t *testing.T) {
+	admin := tgbotapi.User{ID: testAdminID}
+	tests := []struct {
+		text        string
+		wantMethod  string
+		wantParam   string
+		wantDeleted int
+		wantReply   string
+	}{
+		{"/ban spammer", "banChatMember", "", 1, "banned"},
+		{"/kick", "unbanChatMember", "", 1, "kicked"},
+		{"/mute 2h", "restrictChatMember", "until_date", 1, "muted for 2h"},
+		{"/mute", "restrictChatMember", "until_date", 1, "muted for 1h"},
+		{"/ro", "restrictChatMember", "", 1, "is read-only"},
+		{"/ro 1d", "restrictChatMember", "until_date", 1, "is read-only for 1d"},
+		{"/del", "deleteMessage", "", 2, ""},
+		{"/purge", "deleteMessages", "message_ids", 1, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			fake := setupTestBot(t)
+
+			processUpdate(groupCommand(admin, testUser, tt.text))
+
+			calls := fake.methodCalls(tt.wantMethod)
+			if len(calls) == 0 || (tt.wantParam != "" && calls[0].Params.Get(tt.wantParam) == "") {
+				t.Fatalf("%s calls = %v, want %s", tt.wantMethod, calls, tt.wantParam)
+			}
+			if deletes := fake.methodCalls("deleteMessage"); len(deletes) != tt.wantDeleted || deletes[0].Params.Get("message_id") != "88" {
+				t.Fatalf("deleteMessage calls = %v, want command deleted", deletes)
+			}
+			sent := fake.methodCalls("sendMessage")
+			if tt.wantReply == "" {
+				if len(sent) != 0 {
+					t.Fatalf("sendMessage calls = %v, want none", sent)
+				}
+				return
+			}
+			if len(sent) != 1 || !strings.Contains(sent[0].Params.Get("text"), tt.wantReply) {
+				t.Fatalf("sendMessage calls = %v, want %q", sent, tt.wantReply)
+			}
+			if jobs := deleteJobs(); len(jobs) != 1 {
+				t.Fatalf("delete jobs = %+v, want the answer deleted later", jobs)
+			}
+		})
+	}
+}
+
+func Test_moderationCommandByMember(t *testing.T) {
+	fake := setupTestBot(t)
+
+	processUpdate(groupCommand(testUser, tgbotapi.User{ID: 600, FirstName: "Other"}, "/ban"))
+
+	if deletes := fake.methodCalls("deleteMessage"); len(deletes) != 1 {
+		t.Fatalf("deleteMessage calls = %v, want command deleted", deletes)
+	}
+	if bans := fake.methodCalls("banChatMember"); len(bans) != 0 {
+		t.Fatalf("banChatMember calls = %v, want none", bans)
+	}
+	if sent := fake.methodCalls("sendMessage"); len(sent) != 0 {
+		t.Fatalf("sendMessage calls = %v, want silence", sent)
+	}
+}
+
+func Test_moderationCommandOnAdmin(t *testing.T) {
+	fake := setupTestBot(t)
+	admin := tgbotapi.User{ID: testAdminID}
+
+	processUpdate(groupCommand(admin, admin, "/mute 1h"))
+
+	if restricts := fake.methodCalls("restrictChatMember"); len(restricts) != 0 {
+		t.Fatalf("restrictChatMember calls = %v, want admin untouched", restricts)
+	}
+}
+
+// Lifted mute gives back text-only rights to users restricted by ban policy
+func Test_muteRestrictedMedia(t *testing.T) {
+	fake := setupTestBot(t)
+	setBanPolicy()
+	fake.spamFactor[testUser.ID] = 0.7
+	processUpdate(joinUpdate(testUser))
+	welcome := cache.WelcomeQueue()[0]
+	processUpdate(answerUpdate(welcome.ID, welcome.Answer))
+
+	processUpdate(groupCommand(tgbotapi.User{ID: testAdminID}, testUser, "/mute 2h"))
+	fake.reset()
+	scheduler.runDue(time.Now().UTC().Add(3 * time.Hour))
+
+	restricts := fake.methodCalls("restrictChatMember")
+	if len(restricts) != 1 || !strings.Contains(restricts[0].Params.Get("permissions"), `"can_send_messages":true`) {
+		t.Fatalf("restrictChatMember calls = %v, want rights back", restricts)
+	}
+	if strings.Contains(restricts[0].Params.Get("permissions"), `"can_send_photos":true`) {
+		t.Errorf("permissions = %s, want media still restricted", restricts[0].Params.Get("permissions"))
+	}
+}
+
+func Test_purgeMessages(t *testing.T) {
+	fake := setupTestBot(t)
+
+	if counter := purgeMessages(testChatID, 1, 150); counter != 150 {
+		t.Errorf("purgeMessages() = %d, want 150", counter)
+	}
+	if calls := fake.methodCalls("deleteMessages"); len(calls) != 2 {
+		t.Errorf("deleteMessages calls = %v, want 2 batches", calls)
+	}
+	if counter := purgeMessages(testChatID, 1, 5000); counter != PURGE_LIMIT {
+		t.Errorf("purgeMessages() = %d, want %d", counter, PURGE_LIMIT)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+/*
+ - Every moderation action is appended to the moderation log, one json object per line.
+ - Chats with `log_channel` also get actions posted there, with buttons to undo:
+   unban, unmute and restore of deleted messages. Deleted messages are copied to the channel first.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/OvyFlash/telegram-bot-api"
+)
+
+const DEFAULT_MODERATION_LOG = "moderation.jsonl"
+
+type ModerationEntry struct {
+	Time      time.Time `json:"time"`
+	Action    string    `json:"action"`
+	ChatID    int64     `json:"chat_id,omitempty"`
+	UserID    int64     `json:"user_id"`
+	AdminID   int64     `json:"admin_id,omitempty"` //0 is the bot itself
+	Reason    string    `json:"reason,omitempty"`   //Rule or admin's words
+	MessageID int       `json:"message_id,omitempty"`
+	Excerpt   string    `json:"excerpt,omitempty"` //Text of the message
+	Until     time.Time `json:"until,omitempty"`
+	Error     string    `json:"error,omitempty"`
+
+	message *tgbotapi.Message //Deleted message, copied to the log channel
+}
+
+// Text of deleted messages kept in the log
+const EXCERPT_LENGTH = 200
+
+// Undo buttons of the log channel
+const (
+	UNDO_UNBAN   = "undo_unban"
+	UNDO_UNMUTE  = "undo_unmute"
+	UNDO_RESTORE = "undo_restore"
+)
+
+var moderationLogMutex sync.Mutex
+
+func getModerationLog() string {
+	if MainConfig.ModerationLog != "" {
+		return MainConfig.ModerationLog
+	}
+	return DEFAULT_MODERATION_LOG
+}
+
+func logModeration(entry ModerationEntry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	slog.Info("Moderation:", "action", entry.Action, "chat", entry.ChatID, "user", entry.UserID, "admin", entry.AdminID, "error", entry.Error)
+
+	if err := appendModerationLog(entry); err != nil {
+		slog.Warn("Moderation log error:", "error", err)
+	}
+	postModeration(entry)
+}
+
+func appendModerationLog(entry ModerationEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	moderationLogMutex.Lock()
+	defer moderationLogMutex.Unlock()
+	file, err := os.OpenFile(getModerationLog(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = fmt.Fprintf(file, "%s\n", line)
+	return err
+}
+
+// removeMessage deletes the message as a moderation action, the log keeps its text
+func removeMessage(message *tgbotapi.Message, adminID int64, reason string) {
+	logModeration(ModerationEntry{
+		Action:    "delete",
+		ChatID:    message.Chat.ID,
+		UserID:    senderID(message),
+		AdminID:   adminID,
+		Reason:    reason,
+		MessageID: message.MessageID,
+		Excerpt:   excerpt(message.Text + message.Caption),
+		message:   message,
+	})
+	deleteMessage(message.Chat.ID, message.MessageID)
+}
+
+func excerpt(text string) string {
+	if utf8.RuneCountInString(text) <= EXCERPT_LENGTH {
+		return text
+	}
+	return string([]rune(text)[:EXCERPT_LENGTH]) + "…"
+}
+
+func undoButton(text string, command string, data string) tgbotapi.InlineKeyboardButton {
+	return tgbotapi.NewInlineKeyboardButtonData(text, "{\"command\": \""+command+"\", \"data\": \""+data+"\"}")
+}
+
+// postModeration sends the entry to the log channel of the chat
+func postModeration(entry ModerationEntry) {
+	chat := getChatConfig(entry.ChatID)
+	if chat.LogChannel == 0 || bot == nil {
+		return
+	}
+	msg := tgbotapi.NewMessage(chat.LogChannel, moderationText(chat, entry))
+	msg.ParseMode = "HTML"
+	msg.LinkPreviewOptions.IsDisabled = true
+
+	var buttons []tgbotapi.InlineKeyboardButton
+	if entry.message != nil {
+		// Copy is the original for restore, the log message replies to it
+		copied, err := bot.CopyMessage(tgbotapi.NewCopyMessage(chat.LogChannel, entry.ChatID, entry.MessageID))
+		if err != nil {
+			slog.Warn("Log channel copy error:", "error", err)
+		} else {
+			msg.ReplyParameters.MessageID = copied.MessageID
+			buttons = append(buttons, undoButton("Restore", UNDO_RESTORE, fmt.Sprintf("%d:%d", entry.ChatID, copied.MessageID)))
+		}
+	}
+	if entry.Error == "" {
+		switch entry.Action {
+		case "ban", "tempban":
+			buttons = append(buttons, undoButton("Unban", UNDO_UNBAN, strconv.FormatInt(entry.UserID, 10)))
+		case "mute", "ro":
+			buttons = append(buttons, undoButton("Unmute", UNDO_UNMUTE, fmt.Sprintf("%d:%d", entry.ChatID, entry.UserID)))
+		}
+	}
+	if len(buttons) > 0 {
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(buttons)
+	}
+	if _, err := bot.Send(msg); err != nil {
+		slog.Warn("Log channel error:", "error", err)
+	}
+}
+
+func moderationText(chat ChatConfig, entry ModerationEntry) string {
+	title := chat.Title
+	if title == "" {
+		title = strconv.FormatInt(entry.ChatID, 10)
+	}
+	lines := []string{"#" + entry.Action + " in " + html.EscapeString(title)}
+	if entry.UserID != 0 {
+		lines = append(lines, fmt.Sprintf(`User: <a href="tg://user?id=%d">%d</a>`, entry.UserID, entry.UserID))
+	}
+	if entry.AdminID != 0 {
+		lines = append(lines, fmt.Sprintf(`Admin: <a href="tg://user?id=%d">%d</a>`, entry.AdminID, entry.AdminID))
+	} else {
+		lines = append(lines, "Admin: bot")
+	}
+	if entry.Reason != "" {
+		lines = append(lines, "Reason: "+html.EscapeString(entry.Reason))
+	}
+	if !entry.Until.IsZero() {
+		lines = append(lines, "Until: "+entry.Until.Format("2006-01-02 15:04 MST"))
+	}
+	if entry.Error != "" {
+		lines = append(lines, "Error: "+html.EscapeString(entry.Error))
+	}
+	if entry.Excerpt != "" {
+		lines = append(lines, "<blockquote>"+html.EscapeString(entry.Excerpt)+"</blockquote>")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// undoModeration handles buttons of the log channel, returns text for the admin
+func undoModeration(query *tgbotapi.CallbackQuery, command string, data string) string {
+	ids := strings.Split(data, ":")
+	var values []int64
+	for _, id := range ids {
+		value, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return "Wrong button"
+		}
+		values = append(values, value)
+	}
+	adminID := query.From.ID
+	var result string
+	switch {
+	case command == UNDO_UNBAN && len(values) == 1:
+		if len(adminChats(adminID)) == 0 {
+			return "Admins only"
+		}
+		result = unbanUser(values[0], adminID)
+	case command == UNDO_UNMUTE && len(values) == 2:
+		if !isChatAdmin(getChatConfig(values[0]), adminID) {
+			return "Admins only"
+		}
+		liftRestriction(values[0], values[1])
+		logModeration(ModerationEntry{Action: "unmute", ChatID: values[0], UserID: values[1], AdminID: adminID})
+		result = "Unmuted"
+	case command == UNDO_RESTORE && len(values) == 2:
+		if !isChatAdmin(getChatConfig(values[0]), adminID) {
+			return "Admins only"
+		}
+		restored, err := bot.CopyMessage(tgbotapi.NewCopyMessage(values[0], query.Message.Chat.ID, int(values[1])))
+		if err != nil {
+			return "Restore error: " + err.Error()
+		}
+		logModeration(ModerationEntry{Action: "restore", ChatID: values[0], AdminID: adminID, MessageID: restored.MessageID})
+		result = "Restored as a copy"
+	default:
+		return "Wrong button"
+	}
+	// Done, buttons are removed
+	bot.Request(tgbotapi.NewEditMessageReplyMarkup(query.Message.Chat.ID, query.Message.MessageID, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}))
+	return result
+}
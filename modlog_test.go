@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/OvyFlash/telegram-bot-api"
+)
+
+const testLogChannel = -100999
+
+func setLogChannel(t *testing.T) {
+	t.Helper()
+	chat := MainConfig.Chats[testChatID]
+	chat.LogChannel = testLogChannel
+	MainConfig.Chats[testChatID] = chat
+}
+
+// logButtons returns callback data of the buttons posted to the log channel
+func logButtons(t *testing.T, fake *fakeBotAPI) map[string]string {
+	t.Helper()
+	buttons := map[string]string{}
+	for _, call := range fake.methodCalls("sendMessage") {
+		if call.Params.Get("chat_id") != "-100999" || call.Params.Get("reply_markup") == "" {
+			continue
+		}
+		var markup tgbotapi.InlineKeyboardMarkup
+		if err := json.Unmarshal([]byte(call.Params.Get("reply_markup")), &markup); err != nil {
+			t.Fatal(err)
+		}
+		for _, row := range markup.InlineKeyboard {
+			for _, button := range row {
+				buttons[button.Text] = *button.CallbackData
+			}
+		}
+	}
+	return buttons
+}
+
+func undoUpdate(user tgbotapi.User, data string) tgbotapi.Update {
+	return tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:      "3",
+		From:    &user,
+		Message: &tgbotapi.Message{MessageID: 1, Chat: tgbotapi.Chat{ID: testLogChannel, Type: "channel"}},
+		Data:    data,
+	}}
+}
+
+func Test_logChannelRestore(t *testing.T) {
+	fake := setupTestBot(t)
+	setLogChannel(t)
+
+	processUpdate(messageUpdate(testUser, "buy spam text now"))
+
+	copies := fake.methodCalls("copyMessage")
+	if len(copies) != 1 || copies[0].Params.Get("chat_id") != "-100999" || copies[0].Params.Get("message_id") != "77" {
+		t.Fatalf("copyMessage calls = %v, want the message copied to the log channel", copies)
+	}
+	posts := fake.methodCalls("sendMessage")
+	if len(posts) != 1 || !strings.Contains(posts[0].Params.Get("text"), "#delete") || !strings.Contains(posts[0].Params.Get("text"), "buy spam text now") {
+		t.Fatalf("sendMessage calls = %v, want log post with the excerpt", posts)
+	}
+	log, err := os.ReadFile(MainConfig.ModerationLog)
+	if err != nil || !strings.Contains(string(log), `"reason":"forbidden text","message_id":77,"excerpt":"buy spam text now"`) {
+		t.Fatalf("moderation log = %s, %v, want delete entry", log, err)
+	}
+	restore := logButtons(t, fake)["Restore"]
+	if restore == "" {
+		t.Fatalf("log buttons = %v, want Restore", logButtons(t, fake))
+	}
+
+	// Members can't undo
+	fake.reset()
+	processUpdate(undoUpdate(testUser, restore))
+	if copies := fake.methodCalls("copyMessage"); len(copies) != 0 {
+		t.Fatalf("copyMessage calls = %v, want none for a member", copies)
+	}
+
+	processUpdate(undoUpdate(tgbotapi.User{ID: testAdminID}, restore))
+	copies = fake.methodCalls("copyMessage")
+	if len(copies) != 1 || copies[0].Params.Get("chat_id") != "-1001" || copies[0].Params.Get("from_chat_id") != "-100999" {
+		t.Fatalf("copyMessage calls = %v, want the copy restored to the chat", copies)
+	}
+	if edits := fake.methodCalls("editMessageReplyMarkup"); len(edits) != 1 {
+		t.Fatalf("editMessageReplyMarkup calls = %v, want buttons removed", edits)
+	}
+}
+
+func Test_logChannelUnmuteAndUnban(t *testing.T) {
+	fake := setupTestBot(t)
+	setLogChannel(t)
+	admin := tgbotapi.User{ID: testAdminID}
+
+	processUpdate(groupCommand(admin, testUser, "/mute 2h"))
+	unmute := logButtons(t, fake)["Unmute"]
+	if unmute == "" {
+		t.Fatalf("log buttons = %v, want Unmute", logButtons(t, fake))
+	}
+	fake.reset()
+	processUpdate(undoUpdate(admin, unmute))
+	restricts := fake.methodCalls("restrictChatMember")
+	if len(restricts) != 1 || !strings.Contains(restricts[0].Params.Get("permissions"), `"can_send_messages":true`) {
+		t.Fatalf("restrictChatMember calls = %v, want rights restored", restricts)
+	}
+
+	fake.reset()
+	processUpdate(groupCommand(admin, testUser, "/ban spam"))
+	unban := logButtons(t, fake)["Unban"]
+	if unban == "" {
+		t.Fatalf("log buttons = %v, want Unban", logButtons(t, fake))
+	}
+	fake.reset()
+	processUpdate(undoUpdate(admin, unban))
+	if unbans := fake.methodCalls("unbanChatMember"); len(unbans) != 1 {
+		t.Fatalf("unbanChatMember calls = %v, want unban", unbans)
+	}
+	if cache.GetBan(testUser.ID) != nil {
+		t.Fatal("user is still in ban list")
+	}
+}
+
+func Test_moderationText(t *testing.T) {
+	chat := ChatConfig{Title: "<Main>"}
+	text := moderationText(chat, ModerationEntry{Action: "ban", ChatID: testChatID, UserID: 500, Reason: "bad name", Excerpt: "a<b"})
+	for _, want := range []string{"#ban in &lt;Main&gt;", `tg://user?id=500`, "Admin: bot", "Reason: bad name", "<blockquote>a&lt;b</blockquote>"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("moderationText() = %q, want %q", text, want)
+		}
+	}
+	if got := excerpt(strings.Repeat("я", EXCERPT_LENGTH+5)); len([]rune(got)) != EXCERPT_LENGTH+1 {
+		t.Errorf("excerpt() length = %d, want %d", len([]rune(got)), EXCERPT_LENGTH+1)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+/*
+ - `denynames` patterns are substrings or regular expressions with `r:` prefix.
+ - Names and substring patterns are normalized: lowercase, no zero-width chars and accents,
+   fancy font letters and Cyrillic/Greek look-alikes become Latin.
+ - Regular expressions are kept as written, they are case-insensitive and match the normalized or the original name,
+   so Cyrillic patterns work too.
+ - Names are checked on join, join request and on every message, so renamed members are caught too.
+*/
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"unicode"
+
+	tgbotapi "github.com/OvyFlash/telegram-bot-api"
+)
+
+type namePattern struct {
+	text  string
+	regex *regexp.Regexp
+}
+
+// match checks the normalized name, regex also checks the original one
+func (p namePattern) match(name string, original string) bool {
+	if p.regex != nil {
+		return p.regex.MatchString(name) || p.regex.MatchString(original)
+	}
+	return strings.Contains(name, p.text)
+}
+
+// Look-alikes of Latin letters, after lowercase
+var homoglyphs = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p',
+	'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'і': 'i', 'ї': 'i', 'ј': 'j', 'ѕ': 's', 'ԁ': 'd',
+	'ԛ': 'q', 'ԝ': 'w', 'һ': 'h', 'ո': 'n', 'ս': 'u',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p',
+	'τ': 't', 'υ': 'u', 'χ': 'x', 'ω': 'w',
+	// Latin
+	'ı': 'i', 'ɡ': 'g', 'ℓ': 'l', 'ʀ': 'r', 'ꜱ': 's', 'ᴀ': 'a', 'ʙ': 'b', 'ᴄ': 'c', 'ᴅ': 'd',
+	'ᴇ': 'e', 'ɢ': 'g', 'ʜ': 'h', 'ɪ': 'i', 'ᴊ': 'j', 'ᴋ': 'k', 'ʟ': 'l', 'ᴍ': 'm', 'ɴ': 'n',
+	'ᴏ': 'o', 'ᴘ': 'p', 'ᴛ': 't', 'ᴜ': 'u', 'ᴠ': 'v', 'ᴡ': 'w', 'ʏ': 'y', 'ᴢ': 'z',
+}
+
+// Letterlike symbols filling holes of mathematical alphabets
+var letterlike = map[rune]rune{
+	'ℂ': 'c', 'ℊ': 'g', 'ℋ': 'h', 'ℌ': 'h', 'ℍ': 'h', 'ℎ': 'h', 'ℐ': 'i', 'ℑ': 'i', 'ℒ': 'l',
+	'ℕ': 'n', 'ℙ': 'p', 'ℚ': 'q', 'ℛ': 'r', 'ℜ': 'r', 'ℝ': 'r', 'ℤ': 'z', 'ℨ': 'z', 'ℬ': 'b',
+	'ℭ': 'c', 'ℯ': 'e', 'ℰ': 'e', 'ℱ': 'f', 'ℳ': 'm', 'ℴ': 'o',
+}
+
+// plainLetter maps fancy font letters and digits to ASCII
+func plainLetter(r rune) rune {
+	switch {
+	case r >= 0x1D400 && r <= 0x1D6A3: //Mathematical alphabets, 52 letters each
+		return 'a' + (r-0x1D400)%52%26
+	case r >= 0x1D7CE && r <= 0x1D7FF: //Mathematical digits
+		return '0' + (r-0x1D7CE)%10
+	case r >= 0xFF01 && r <= 0xFF5E: //Fullwidth
+		return r - 0xFEE0
+	case r >= 0x24B6 && r <= 0x24CF: //Circled capitals
+		return 'a' + r - 0x24B6
+	case r >= 0x24D0 && r <= 0x24E9: //Circled small
+		return 'a' + r - 0x24D0
+	case r >= 0x1F130 && r <= 0x1F189: //Squared and negative circled capitals
+		return 'a' + (r-0x1F130)%26
+	case r >= 0x1F1E6 && r <= 0x1F1FF: //Regional indicators
+		return 'a' + r - 0x1F1E6
+	}
+	if plain, ok := letterlike[r]; ok {
+		return plain
+	}
+	return r
+}
+
+// normalizeText makes look-alike texts equal
+func normalizeText(text string) string {
+	var builder strings.Builder
+	for _, r := range text {
+		// Zero-width, joiners, direction marks, variation selectors, accents
+		if unicode.Is(unicode.Cf, r) || unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Variation_Selector, r) {
+			continue
+		}
+		r = unicode.ToLower(plainLetter(r))
+		if latin, ok := homoglyphs[r]; ok {
+			r = latin
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
+
+// compileNamePatterns normalizes substring patterns, regex patterns start with `r:`.
+// Lowercasing would turn \S into \s, so regex source is not normalized.
+func compileNamePatterns(patterns []string) ([]namePattern, error) {
+	var compiled []namePattern
+	for _, pattern := range patterns {
+		if regex, ok := strings.CutPrefix(pattern, "r:"); ok {
+			re, err := regexp.Compile("(?i)" + regex)
+			if err != nil {
+				return nil, fmt.Errorf("denynames %q: %w", pattern, err)
+			}
+			compiled = append(compiled, namePattern{text: pattern, regex: re})
+			continue
+		}
+		if text := normalizeText(pattern); text != "" {
+			compiled = append(compiled, namePattern{text: text})
+		}
+	}
+	return compiled, nil
+}
+
+// readDenyNames compiles `denynames` of all chats
+func readDenyNames() error {
+	var err error
+	if MainConfig.ChatConfig.denyNames, err = compileNamePatterns(MainConfig.ChatConfig.DenyNames); err != nil {
+		return err
+	}
+	for id, chat := range MainConfig.Chats {
+		if chat.denyNames, err = compileNamePatterns(chat.DenyNames); err != nil {
+			return fmt.Errorf("chat %d: %w", id, err)
+		}
+		MainConfig.Chats[id] = chat
+	}
+	return nil
+}
+
+func isBadName(chat ChatConfig, member *tgbotapi.ChatMemberUpdated) bool {
+	if member.NewChatMember.User == nil {
+		return false
+	}
+	return isBadUserName(chat, *member.NewChatMember.User)
+}
+
+func isBadUserName(chat ChatConfig, user tgbotapi.User) bool {
+	original := user.FirstName + " " + user.LastName + " " + user.UserName
+	name := normalizeText(original)
+	for _, pattern := range chat.denyNames {
+		if pattern.match(name, original) {
+			slog.Info("BadName:"+user.FirstName+" "+user.LastName+" "+user.UserName, "pattern", pattern.text)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+
+	tgbotapi "github.com/OvyFlash/telegram-bot-api"
+)
+
+func Test_normalizeText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"Plain", "Crypto Signals", "crypto signals"},
+		{"Cyrillic", "Сrурtо", "crypto"},
+		{"Greek", "Cαsιnο", "casino"},
+		{"ZeroWidth", "cr​ypt‍o️", "crypto"},
+		{"Accents", "crýpto", "crypto"},
+		{"Bold", "𝐂𝐫𝐲𝐩𝐭𝐨", "crypto"},
+		{"Script", "ℭ𝓇𝓎𝓅𝓉ℴ", "crypto"},
+		{"Fullwidth", "ＣＲＹＰＴＯ", "crypto"},
+		{"Circled", "ⓒⓡⓨⓟⓣⓞ", "crypto"},
+		{"SmallCaps", "ᴄʀʏᴘᴛᴏ", "crypto"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeText(tt.text); got != tt.want {
+				t.Errorf("normalizeText(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_isBadUserName(t *testing.T) {
+	patterns, err := compileNamePatterns([]string{"crypto", `r:^\d+$`, "r:inv[e3]st", `r:^\S+bot\b`, `r:^Promo\D{2}\d`, "r:крипто"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chat := ChatConfig{denyNames: patterns}
+	tests := []struct {
+		name string
+		user tgbotapi.User
+		want bool
+	}{
+		{"Clean", tgbotapi.User{FirstName: "Ivan", LastName: "Petrov"}, false},
+		{"Substring", tgbotapi.User{FirstName: "Best", LastName: "𝐂𝐫𝐲𝐩𝐭𝐨"}, true},
+		{"Username", tgbotapi.User{FirstName: "Anna", UserName: "crypto_anna"}, true},
+		{"Regex", tgbotapi.User{FirstName: "Inv3st", LastName: "now"}, true},
+		{"RegexNotMatched", tgbotapi.User{FirstName: "123", LastName: "Anna"}, false},
+		{"RegexUpperEscape", tgbotapi.User{FirstName: "Cashbot", LastName: "Official"}, true},
+		{"RegexUpperEscapeNotMatched", tgbotapi.User{FirstName: "Bot", LastName: "Anna"}, false},
+		{"RegexCase", tgbotapi.User{FirstName: "PROMOxx7"}, true},
+		{"RegexCyrillic", tgbotapi.User{FirstName: "Крипто", LastName: "Иван"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isBadUserName(chat, tt.user); got != tt.want {
+				t.Errorf("isBadUserName(%+v) = %v, want %v", tt.user, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := compileNamePatterns([]string{"r:("}); err == nil {
+		t.Errorf("compileNamePatterns() accepted broken regex")
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+/*
+ - Ban providers signals are combined into one score.
+ - Score thresholds map to actions: allow, captcha, restrict_media, ban.
+ - Borderline users get a question instead of the button, restrict_media users also get text-only rights.
+*/
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+const (
+	ACTION_ALLOW          = "allow"
+	ACTION_CAPTCHA        = "captcha"
+	ACTION_RESTRICT_MEDIA = "restrict_media"
+	ACTION_BAN            = "ban"
+)
+
+// BanPolicy thresholds, 0 disables the action
+type BanPolicy struct {
+	SpamFactorWeight float64 `yaml:"spam_factor_weight"` //lols.bot spam_factor(0..1) multiplier
+	OffenseWeight    float64 `yaml:"offense_weight"`     //Score for every offense
+	Captcha          float64 `yaml:"captcha"`
+	RestrictMedia    float64 `yaml:"restrict_media"`
+	Ban              float64 `yaml:"ban"` //1 by default
+}
+
+// policyScore adds spam factor and offenses to weights of ban lists
+func policyScore(policy BanPolicy, results []BanResult) float64 {
+	score := banScore(results)
+	for _, result := range results {
+		score += result.Weight * (float64(result.Score)*policy.SpamFactorWeight + float64(result.Offenses)*policy.OffenseWeight)
+	}
+	return score
+}
+
+func policyAction(policy BanPolicy, score float64) string {
+	ban := policy.Ban
+	if ban == 0 {
+		ban = 1
+	}
+	switch {
+	case score >= ban:
+		return ACTION_BAN
+	case policy.RestrictMedia > 0 && score >= policy.RestrictMedia:
+		return ACTION_RESTRICT_MEDIA
+	case policy.Captcha > 0 && score >= policy.Captcha:
+		return ACTION_CAPTCHA
+	}
+	return ACTION_ALLOW
+}
+
+// userBanAction checks user with all providers and applies chat policy
+func userBanAction(chat ChatConfig, userid int64) string {
+	score := policyScore(chat.BanPolicy, checkBanProviders(userid))
+	action := policyAction(chat.BanPolicy, score)
+	slog.Info(fmt.Sprintf("User %d policy score %.2f in chat %d: %s", userid, score, chat.ID, action))
+	return action
+}
+
+// grantUserRights checks user again after the challenge, returns text for the user
+func grantUserRights(chatID int64, userid int64) string {
+	switch userBanAction(getChatConfig(chatID), userid) {
+	case ACTION_BAN:
+		banUser(chatID, userid, 0, "ban lists")
+		return "Sorry, Api Ban"
+	case ACTION_RESTRICT_MEDIA:
+		restrictUserMedia(chatID, userid)
+		return "Rights upgraded, media is not allowed yet"
+	default:
+		upgradeUserRights(chatID, userid)
+		return "Rights upgraded!"
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func Test_policyAction(t *testing.T) {
+	policy := BanPolicy{SpamFactorWeight: 1, OffenseWeight: 0.1, Captcha: 0.3, RestrictMedia: 0.6, Ban: 1}
+	tests := []struct {
+		name    string
+		policy  BanPolicy
+		results []BanResult
+		want    string
+	}{
+		{"Clean", policy, []BanResult{{Weight: 1}, {Weight: 1}}, ACTION_ALLOW},
+		{"SpamFactorCaptcha", policy, []BanResult{{Weight: 1, Score: 0.4}}, ACTION_CAPTCHA},
+		{"OffensesRestrictMedia", policy, []BanResult{{Weight: 1, Score: 0.3, Offenses: 4}}, ACTION_RESTRICT_MEDIA},
+		{"ProviderWeightScales", policy, []BanResult{{Weight: 0.5, Score: 0.4}}, ACTION_ALLOW},
+		{"Banned", policy, []BanResult{{Weight: 1, Banned: true}}, ACTION_BAN},
+		{"SignalsSumToBan", policy, []BanResult{{Weight: 0.5, Banned: true, Score: 1}}, ACTION_BAN},
+		{"DefaultBanOnly", BanPolicy{}, []BanResult{{Weight: 1, Score: 0.9, Offenses: 10}}, ACTION_ALLOW},
+		{"DefaultBan", BanPolicy{}, []BanResult{{Weight: 1, Banned: true}}, ACTION_BAN},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policyAction(tt.policy, policyScore(tt.policy, tt.results)); got != tt.want {
+				t.Errorf("policyAction() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
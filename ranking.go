@@ -1,32 +1,203 @@
 package main
 
-func getRank(rankId int) string {
-	return "Rank"
+/*
+ - Messages are counted per user per chat, `ranks` maps message count to a title.
+ - Crossing a threshold is announced with `rankMessage`.
+ - Anti-farming: short messages and messages within cooldown are not counted,
+   spam is deleted before counting, so it's never counted.
+ - /rank shows level and progress, /top shows daily, weekly or all-time leaders.
+*/
+
+import (
+	"fmt"
+	"html"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/OvyFlash/telegram-bot-api"
+)
+
+const DEFAULT_RANK_MIN_LENGTH = 5
+const DEFAULT_RANK_COOLDOWN = 10 * time.Second
+const TOP_LIMIT = 10
+
+type RankLevel struct {
+	Messages int
+	Title    string
 }
 
-func rankUp() {
+// getRanks returns chat levels sorted by messages
+func getRanks(chat ChatConfig) ([]RankLevel, error) {
+	var levels []RankLevel
+	for messages, title := range chat.Ranks {
+		count, err := strconv.Atoi(messages)
+		if err != nil || count < 0 {
+			return nil, fmt.Errorf("rank %q: messages count expected", messages)
+		}
+		levels = append(levels, RankLevel{Messages: count, Title: title})
+	}
+	sort.Slice(levels, func(i, j int) bool {
+		return levels[i].Messages < levels[j].Messages
+	})
+	return levels, nil
+}
 
+// getRank returns level number and rank for the message count, level 0 is below all thresholds
+func getRank(chat ChatConfig, messageCount int) (int, RankLevel) {
+	levels, _ := getRanks(chat)
+	level, current := 0, RankLevel{}
+	for id, rank := range levels {
+		if messageCount >= rank.Messages {
+			level, current = id+1, rank
+		}
+	}
+	return level, current
 }
 
-func readRanks() {
-	//Get table userid:messageCount to memory
-	//every 50 messages or on rankUp save progress
+// readRanks checks `ranks` of all chats
+func readRanks() error {
+	for _, chat := range allChatConfigs() {
+		if _, err := getRanks(chat); err != nil {
+			return fmt.Errorf("chat %d: %w", chat.ID, err)
+		}
+	}
+	return nil
 }
 
-/*func checkAndNotifyRank(bot *tgbotapi.BotAPI, update tgbotapi.Update, userID int, messageCount int, ranks map[string]string) {
-	// Example: Check if the message count reaches a certain threshold for rank upgrade
-	// This logic can be more complex based on how you want to calculate ranks
-	var newRank string
-	if messageCount == 10 {
-		newRank = ranks["10"]
-	} else if messageCount == 50 {
-		newRank = ranks["50"]
-	} else if messageCount == 100 {
-		newRank = ranks["100"]
+// isRankMessage filters messages which don't count
+func isRankMessage(chat ChatConfig, message *tgbotapi.Message) bool {
+	if message.From == nil || message.From.IsBot || message.SenderChat != nil || message.Chat.IsPrivate() {
+		return false
+	}
+	minLength := chat.RankMinLength
+	if minLength == 0 {
+		minLength = DEFAULT_RANK_MIN_LENGTH
 	}
+	text := strings.TrimSpace(message.Text + message.Caption)
+	return utf8.RuneCountInString(text) >= minLength
+}
 
-	if newRank != "" {
-		msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Congratulations, you've been promoted to "+newRank+"!")
-		bot.Send(msg)
+// countMessage adds the message to user stats and announces a new rank
+func countMessage(chat ChatConfig, message *tgbotapi.Message) {
+	if !isRankMessage(chat, message) {
+		return
+	}
+	cooldown := chat.RankCooldown
+	if cooldown == 0 {
+		cooldown = DEFAULT_RANK_COOLDOWN
 	}
-}*/
+	now := message.Time().UTC()
+	if stats := cache.GetStats(message.From.ID, message.Chat.ID); stats != nil && now.Sub(stats.LastMessage) < cooldown {
+		return
+	}
+
+	stats := cache.AddMessage(message.From.ID, message.Chat.ID, now)
+	level, rank := getRank(chat, stats.MessageCount)
+	if level > stats.Rank {
+		stats.Rank = level
+		cache.SetStats(stats)
+		rankUp(chat, message, level, rank)
+	}
+}
+
+func rankUp(chat ChatConfig, message *tgbotapi.Message, level int, rank RankLevel) {
+	slog.Info(fmt.Sprintf("User %s(%d) got rank %d in chat %d", message.From.UserName, message.From.ID, level, message.Chat.ID))
+	// Rank for 0 messages is given for nothing
+	if rank.Messages == 0 || chat.RankMessage == "" {
+		return
+	}
+	text := strings.NewReplacer(
+		"{name}", getNameLink(*message.From),
+		"{newlvl}", strconv.Itoa(level),
+		"{newrank}", rank.Title,
+	).Replace(chat.RankMessage)
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	msg.ParseMode = "HTML"
+	msg.LinkPreviewOptions.IsDisabled = true
+	if emulate {
+		slog.Info(text)
+		return
+	}
+	sent, err := bot.Send(msg)
+	if err != nil {
+		slog.Warn("Rank message error:", "error", err)
+		return
+	}
+	delayDeleteTrigger(sent, message.From.ID)
+}
+
+func getUserName(user tgbotapi.User) string {
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if name == "" {
+		name = user.UserName
+	}
+	return html.EscapeString(name)
+}
+
+// rankCommand shows rank of the sender or of the replied user
+func rankCommand(chat ChatConfig, message tgbotapi.Message) string {
+	levels, _ := getRanks(chat)
+	if len(levels) == 0 {
+		return "Ranks are not set for this chat"
+	}
+	user := *message.From
+	if message.ReplyToMessage != nil && message.ReplyToMessage.From != nil && !message.ReplyToMessage.From.IsBot {
+		user = *message.ReplyToMessage.From
+	}
+
+	count := 0
+	if stats := cache.GetStats(user.ID, message.Chat.ID); stats != nil {
+		count = stats.MessageCount
+	}
+	level, rank := getRank(chat, count)
+	text := fmt.Sprintf("<b>%s</b>: %d messages", getUserName(user), count)
+	if level > 0 {
+		text += fmt.Sprintf(", level %d «%s»", level, html.EscapeString(rank.Title))
+	}
+	if level < len(levels) {
+		next := levels[level]
+		text += fmt.Sprintf("\r\n%d more to level %d «%s»", next.Messages-count, level+1, html.EscapeString(next.Title))
+	}
+	return text
+}
+
+// topCommand shows leaders, /top day, /top week or /top for all-time
+func topCommand(chat ChatConfig, message tgbotapi.Message) string {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	title, since := "Top of all time", time.Time{}
+	switch strings.ToLower(strings.TrimSpace(message.CommandArguments())) {
+	case "day", "today":
+		title, since = "Top of the day", today
+	case "week":
+		title, since = "Top of the week", today.AddDate(0, 0, -(STATS_DAYS-1))
+	}
+
+	top := cache.TopStats(message.Chat.ID, since, TOP_LIMIT)
+	if len(top) == 0 {
+		return title + ": no messages yet"
+	}
+	lines := []string{"<b>" + title + "</b>"}
+	for id, stats := range top {
+		lines = append(lines, fmt.Sprintf("%d. %s — %d", id+1, chatMemberName(message.Chat.ID, stats.Id), stats.MessageCount))
+	}
+	return strings.Join(lines, "\r\n")
+}
+
+// chatMemberName asks the chat for the name, users are not mentioned to avoid pings
+func chatMemberName(chatID int64, userID int64) string {
+	member, err := bot.GetChatMember(tgbotapi.GetChatMemberConfig{
+		ChatConfigWithUser: tgbotapi.ChatConfigWithUser{
+			ChatConfig: tgbotapi.ChatConfig{ChatID: chatID},
+			UserID:     userID,
+		},
+	})
+	if err != nil || member.User == nil || getUserName(*member.User) == "" {
+		return strconv.FormatInt(userID, 10)
+	}
+	return getUserName(*member.User)
+}
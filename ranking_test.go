@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+
+	tgbotapi "github.com/OvyFlash/telegram-bot-api"
+)
+
+func Test_getRank(t *testing.T) {
+	chat := ChatConfig{Ranks: map[string]string{"0": "Newbie", "100": "Tourist", "10": "Guest"}}
+	tests := []struct {
+		messages  int
+		wantLevel int
+		wantTitle string
+	}{
+		{0, 1, "Newbie"},
+		{9, 1, "Newbie"},
+		{10, 2, "Guest"},
+		{150, 3, "Tourist"},
+	}
+	for _, tt := range tests {
+		level, rank := getRank(chat, tt.messages)
+		if level != tt.wantLevel || rank.Title != tt.wantTitle {
+			t.Errorf("getRank(%d) = %d %s, want %d %s", tt.messages, level, rank.Title, tt.wantLevel, tt.wantTitle)
+		}
+	}
+
+	if level, _ := getRank(ChatConfig{Ranks: map[string]string{"10": "Guest"}}, 5); level != 0 {
+		t.Errorf("getRank() = %d below all thresholds, want 0", level)
+	}
+	if _, err := getRanks(ChatConfig{Ranks: map[string]string{"many": "Guest"}}); err == nil {
+		t.Errorf("getRanks() accepted wrong messages count")
+	}
+}
+
+func Test_isRankMessage(t *testing.T) {
+	chat := ChatConfig{RankMinLength: 5}
+	user := &tgbotapi.User{ID: 1}
+	group := tgbotapi.Chat{ID: -100, Type: "supergroup"}
+	tests := []struct {
+		name    string
+		message tgbotapi.Message
+		want    bool
+	}{
+		{"Text", tgbotapi.Message{From: user, Chat: group, Text: "Hello there"}, true},
+		{"Caption", tgbotapi.Message{From: user, Chat: group, Caption: "Nice photo"}, true},
+		{"Short", tgbotapi.Message{From: user, Chat: group, Text: "ok  "}, false},
+		{"ShortCyrillic", tgbotapi.Message{From: user, Chat: group, Text: "да да"}, true},
+		{"Bot", tgbotapi.Message{From: &tgbotapi.User{ID: 2, IsBot: true}, Chat: group, Text: "Hello there"}, false},
+		{"Private", tgbotapi.Message{From: user, Chat: tgbotapi.Chat{ID: 1, Type: "private"}, Text: "Hello there"}, false},
+		{"Channel", tgbotapi.Message{From: user, SenderChat: &tgbotapi.Chat{ID: -200}, Chat: group, Text: "Hello there"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRankMessage(chat, &tt.message); got != tt.want {
+				t.Errorf("isRankMessage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+/*
+ - One goroutine runs timed jobs: message deletion, challenge timeout kicks, lifting restrictions, reminders.
+ - Jobs are kept in a min-heap by due time and persisted in the cache, so they survive restarts.
+ - Welcome and trigger queues left by older versions are turned into jobs on start.
+*/
+
+import (
+	"container/heap"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/OvyFlash/telegram-bot-api"
+)
+
+const (
+	JOB_DELETE_MESSAGE   = "delete_message"
+	JOB_KICK             = "kick"             //Challenge timeout, skipped if the challenge is solved
+	JOB_LIFT_RESTRICTION = "lift_restriction" //Rights of the reached tier are given back
+	JOB_REMINDER         = "reminder"         //Reply to the challenge if it's not solved yet
+)
+
+// Trigger replies and user triggers are deleted after
+const TRIGGER_TTL = 44 * time.Hour
+
+const DEFAULT_REMINDER_MESSAGE = "{namelink}, please answer the question above"
+
+type Job struct {
+	ID        int64     `json:"id"`
+	Kind      string    `json:"kind"`
+	ChatID    int64     `json:"chat_id"`
+	UserID    int64     `json:"user_id,omitempty"`
+	MessageID int       `json:"message_id,omitempty"`
+	Text      string    `json:"text,omitempty"`
+	Due       time.Time `json:"due"`
+}
+
+type jobHeap []Job
+
+func (h jobHeap) Len() int           { return len(h) }
+func (h jobHeap) Less(i, j int) bool { return h[i].Due.Before(h[j].Due) }
+func (h jobHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *jobHeap) Push(x any)        { *h = append(*h, x.(Job)) }
+func (h *jobHeap) Pop() any {
+	old := *h
+	job := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return job
+}
+
+type Scheduler struct {
+	mu   sync.Mutex
+	jobs jobHeap
+	wake chan struct{}
+}
+
+var scheduler = newScheduler()
+
+func newScheduler() *Scheduler {
+	return &Scheduler{wake: make(chan struct{}, 1)}
+}
+
+// schedule saves the job and wakes the scheduler if the job is the next one
+func schedule(job Job) {
+	scheduler.push(cache.AddJob(job))
+}
+
+func (s *Scheduler) push(job Job) {
+	s.mu.Lock()
+	heap.Push(&s.jobs, job)
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next returns time until the first job
+func (s *Scheduler) next(now time.Time) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.jobs) == 0 {
+		return 0, false
+	}
+	return s.jobs[0].Due.Sub(now), true
+}
+
+func (s *Scheduler) popDue(now time.Time) []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var jobs []Job
+	for len(s.jobs) > 0 && !s.jobs[0].Due.After(now) {
+		jobs = append(jobs, heap.Pop(&s.jobs).(Job))
+	}
+	return jobs
+}
+
+// runDue runs jobs due by now, returns number of jobs
+func (s *Scheduler) runDue(now time.Time) int {
+	jobs := s.popDue(now)
+	for _, job := range jobs {
+		runJob(job)
+		cache.RemoveJob(job.ID)
+	}
+	return len(jobs)
+}
+
+// load fills the heap from the cache
+func (s *Scheduler) load() {
+	jobs := cache.Jobs()
+	s.mu.Lock()
+	s.jobs = jobHeap(jobs)
+	heap.Init(&s.jobs)
+	s.mu.Unlock()
+	slog.Info(fmt.Sprintf("Scheduler loaded %d jobs", len(jobs)))
+}
+
+func (s *Scheduler) run() {
+	for {
+		wait, ok := s.next(time.Now().UTC())
+		if !ok {
+			wait = time.Hour
+		}
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-s.wake:
+				timer.Stop()
+				continue
+			}
+		}
+		s.runDue(time.Now().UTC())
+	}
+}
+
+func startScheduler() {
+	migrateQueues()
+	scheduler.load()
+	go scheduler.run()
+}
+
+// migrateQueues schedules welcome timeouts which have no job and moves trigger queue to jobs
+func migrateQueues() {
+	kicks := make(map[string]bool)
+	for _, job := range cache.Jobs() {
+		if job.Kind == JOB_KICK {
+			kicks[fmt.Sprintf("%d:%d", job.ChatID, job.MessageID)] = true
+		}
+	}
+	for _, welcome := range cache.WelcomeQueue() {
+		if !kicks[fmt.Sprintf("%d:%d", welcome.ChatID, welcome.ID)] {
+			cache.AddJob(Job{Kind: JOB_KICK, ChatID: welcome.ChatID, UserID: welcome.UserID, MessageID: welcome.ID, Due: welcome.Timestamp})
+		}
+	}
+	for _, trigger := range cache.PopExpiredTriggers(time.Unix(1<<62, 0)) {
+		cache.AddJob(Job{Kind: JOB_DELETE_MESSAGE, ChatID: trigger.ChatID, UserID: trigger.UserID, MessageID: trigger.ID, Due: trigger.Timestamp})
+	}
+}
+
+func runJob(job Job) {
+	slog.Debug("Running job", "job", job)
+	switch job.Kind {
+	case JOB_DELETE_MESSAGE:
+		deleteMessage(job.ChatID, job.MessageID)
+	case JOB_KICK:
+		welcome := cache.GetWelcome(job.ChatID, job.MessageID)
+		if welcome == nil || welcome.UserID != job.UserID {
+			return
+		}
+		slog.Info(fmt.Sprintf("Challenge timeout for user %d in chat %d", job.UserID, job.ChatID))
+		deleteMessage(welcome.ChatID, welcome.ID)
+		failChallenge(*welcome, "captcha timeout")
+	case JOB_LIFT_RESTRICTION:
+		liftRestriction(job.ChatID, job.UserID)
+	case JOB_REMINDER:
+		welcome := cache.GetWelcome(job.ChatID, job.MessageID)
+		if welcome == nil || welcome.UserID != job.UserID {
+			return
+		}
+		msg := tgbotapi.NewMessage(job.ChatID, job.Text)
+		msg.ParseMode = "HTML"
+		msg.ReplyParameters.MessageID = job.MessageID
+		sent, err := bot.Send(msg)
+		if err != nil {
+			slog.Warn("Reminder error:", "error", err)
+			return
+		}
+		// Reminder goes away with the challenge
+		schedule(Job{Kind: JOB_DELETE_MESSAGE, ChatID: job.ChatID, MessageID: sent.MessageID, Due: welcome.Timestamp})
+	default:
+		slog.Warn("Unknown job", "job", job)
+	}
+}
+
+// scheduleChallenge plans timeout and reminder for the welcome message
+func scheduleChallenge(chat ChatConfig, welcome WelcomeMessage, user tgbotapi.User) {
+	schedule(Job{Kind: JOB_KICK, ChatID: welcome.ChatID, UserID: welcome.UserID, MessageID: welcome.ID, Due: welcome.Timestamp})
+	if chat.CaptchaReminder <= 0 || chat.CaptchaReminder >= getCaptchaTimeout(chat) {
+		return
+	}
+	template := chat.ReminderMessage
+	if template == "" {
+		template = DEFAULT_REMINDER_MESSAGE
+	}
+	schedule(Job{
+		Kind:      JOB_REMINDER,
+		ChatID:    welcome.ChatID,
+		UserID:    welcome.UserID,
+		MessageID: welcome.ID,
+		Text:      strings.Replace(template, "{namelink}", getNameLink(user), -1),
+		Due:       time.Now().UTC().Add(chat.CaptchaReminder),
+	})
+}
+
+// liftRestriction gives back rights of the applied tier after a temporary restriction
+func liftRestriction(chatID int64, userID int64) {
+	rights := defaultRightsTiers[0].permissions()
+	if stats := cache.GetStats(userID, chatID); stats != nil && stats.MediaFrozen {
+		rights = textOnlyRights
+	} else if stats != nil && !stats.Joined.IsZero() {
+		tiers := getRightsTiers(getChatConfig(chatID))
+		rights = tgbotapi.ChatPermissions{CanSendMessages: true}
+		if stats.Tier > 0 {
+			rights = tiers[min(stats.Tier, len(tiers))-1].permissions()
+		}
+	}
+	slog.Info(fmt.Sprintf("Restriction lifted for user %d in chat %d", userID, chatID))
+	restrictChatMember(chatID, userID, rights, true)
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_schedulerOrder(t *testing.T) {
+	now := time.Now().UTC()
+	s := newScheduler()
+	for _, minutes := range []int{30, -5, 10, -20, 0} {
+		s.push(Job{Kind: JOB_DELETE_MESSAGE, MessageID: minutes, Due: now.Add(time.Duration(minutes) * time.Minute)})
+	}
+
+	due := s.popDue(now)
+	if len(due) != 3 || due[0].MessageID != -20 || due[1].MessageID != -5 || due[2].MessageID != 0 {
+		t.Errorf("popDue() = %+v, want -20, -5 and 0 in order", due)
+	}
+	if wait, ok := s.next(now); !ok || wait != 10*time.Minute {
+		t.Errorf("next() = %v, %v, want 10m", wait, ok)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+/*
+ - Rights tiers: newcomers get more rights with messages, rank or days in chat.
+ - Tier is reached when any of its conditions is met, tier without conditions is the base one.
+ - Rights are only upgraded, members who joined before the bot saw them are not touched.
+ - Users restricted to text by the ban policy are not upgraded until they join again.
+*/
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	tgbotapi "github.com/OvyFlash/telegram-bot-api"
+)
+
+type RightsTier struct {
+	Messages int      `yaml:"messages"`
+	Rank     int      `yaml:"rank"`
+	Days     int      `yaml:"days"`
+	Rights   []string `yaml:"rights"`
+}
+
+// Names of rights in `rights_tiers`
+var rightsNames = map[string]func(*tgbotapi.ChatPermissions){
+	"messages":    func(p *tgbotapi.ChatPermissions) { p.CanSendMessages = true },
+	"audios":      func(p *tgbotapi.ChatPermissions) { p.CanSendAudios = true },
+	"documents":   func(p *tgbotapi.ChatPermissions) { p.CanSendDocuments = true },
+	"photos":      func(p *tgbotapi.ChatPermissions) { p.CanSendPhotos = true },
+	"videos":      func(p *tgbotapi.ChatPermissions) { p.CanSendVideos = true },
+	"video_notes": func(p *tgbotapi.ChatPermissions) { p.CanSendVideoNotes = true },
+	"voice_notes": func(p *tgbotapi.ChatPermissions) { p.CanSendVoiceNotes = true },
+	"media":       func(p *tgbotapi.ChatPermissions) { p.SetCanSendMediaMessages(true) },
+	"polls":       func(p *tgbotapi.ChatPermissions) { p.CanSendPolls = true },
+	"other":       func(p *tgbotapi.ChatPermissions) { p.CanSendOtherMessages = true }, //Stickers, GIFs, games
+	"previews":    func(p *tgbotapi.ChatPermissions) { p.CanAddWebPagePreviews = true },
+	"invite":      func(p *tgbotapi.ChatPermissions) { p.CanInviteUsers = true },
+}
+
+// Everyone who passed welcome gets all rights if tiers are not set
+var defaultRightsTiers = []RightsTier{
+	{Rights: []string{"messages", "media", "polls", "other", "previews", "invite"}},
+}
+
+func getRightsTiers(chat ChatConfig) []RightsTier {
+	if len(chat.RightsTiers) == 0 {
+		return defaultRightsTiers
+	}
+	return chat.RightsTiers
+}
+
+func (tier RightsTier) permissions() tgbotapi.ChatPermissions {
+	var permissions tgbotapi.ChatPermissions
+	for _, name := range tier.Rights {
+		if set, ok := rightsNames[name]; ok {
+			set(&permissions)
+		}
+	}
+	return permissions
+}
+
+func (tier RightsTier) isReached(stats ChatMember, now time.Time) bool {
+	if tier.Messages == 0 && tier.Rank == 0 && tier.Days == 0 {
+		return true
+	}
+	return tier.Messages > 0 && stats.MessageCount >= tier.Messages ||
+		tier.Rank > 0 && stats.Rank >= tier.Rank ||
+		tier.Days > 0 && now.Sub(stats.Joined) >= time.Duration(tier.Days)*24*time.Hour
+}
+
+// reachedTier returns number of the highest reached tier, 0 if none
+func reachedTier(tiers []RightsTier, stats ChatMember, now time.Time) int {
+	reached := 0
+	for id, tier := range tiers {
+		if tier.isReached(stats, now) {
+			reached = id + 1
+		}
+	}
+	return reached
+}
+
+// readRightsTiers checks rights names of all chats
+func readRightsTiers() error {
+	for _, chat := range allChatConfigs() {
+		for _, tier := range chat.RightsTiers {
+			for _, name := range tier.Rights {
+				if _, ok := rightsNames[name]; !ok {
+					return fmt.Errorf("chat %d: unknown right %q in rights_tiers", chat.ID, name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// memberJoined starts tiers from the beginning for the newcomer
+func memberJoined(chatID int64, userID int64) {
+	stats := ChatMember{Id: userID, ChatId: chatID}
+	if current := cache.GetStats(userID, chatID); current != nil {
+		stats = *current
+	}
+	stats.Joined = time.Now().UTC()
+	stats.Tier = 0
+	stats.MediaFrozen = false
+	cache.SetStats(stats)
+}
+
+// applyRightsTier sets rights of the reached tier, rights are never lowered
+func applyRightsTier(chat ChatConfig, chatID int64, userID int64) {
+	stats := cache.GetStats(userID, chatID)
+	if stats == nil || stats.Joined.IsZero() || stats.MediaFrozen || hasPendingChallenge(chatID, userID) {
+		return
+	}
+	tiers := getRightsTiers(chat)
+	tier := reachedTier(tiers, *stats, time.Now().UTC())
+	if tier <= stats.Tier {
+		return
+	}
+	slog.Info(fmt.Sprintf("User %d reached rights tier %d in chat %d", userID, tier, chatID))
+	setUserRights(chatID, userID, tiers[tier-1].permissions(), true)
+	stats.Tier = tier
+	cache.SetStats(*stats)
+}
+
+// freezeMediaRights keeps text-only rights until the user joins again
+func freezeMediaRights(chatID int64, userID int64) {
+	stats := ChatMember{Id: userID, ChatId: chatID}
+	if current := cache.GetStats(userID, chatID); current != nil {
+		stats = *current
+	}
+	stats.MediaFrozen = true
+	cache.SetStats(stats)
+}
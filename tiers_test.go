@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_reachedTier(t *testing.T) {
+	now := time.Now()
+	tiers := []RightsTier{
+		{Rights: []string{"messages"}},
+		{Messages: 20, Days: 3, Rights: []string{"messages", "media"}},
+		{Rank: 3, Rights: []string{"messages", "media", "polls", "previews"}},
+	}
+	tests := []struct {
+		name  string
+		stats ChatMember
+		want  int
+	}{
+		{"Newcomer", ChatMember{MessageCount: 5, Joined: now}, 1},
+		{"Messages", ChatMember{MessageCount: 20, Joined: now}, 2},
+		{"Days", ChatMember{MessageCount: 1, Joined: now.Add(-73 * time.Hour)}, 2},
+		{"Rank", ChatMember{MessageCount: 1, Rank: 3, Joined: now}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reachedTier(tiers, tt.stats, now); got != tt.want {
+				t.Errorf("reachedTier() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	if got := reachedTier(tiers[1:], ChatMember{Joined: now}, now); got != 0 {
+		t.Errorf("reachedTier() = %d without base tier, want 0", got)
+	}
+}
+
+func Test_tierPermissions(t *testing.T) {
+	permissions := RightsTier{Rights: []string{"messages", "photos", "previews"}}.permissions()
+	if !permissions.CanSendMessages || !permissions.CanSendPhotos || !permissions.CanAddWebPagePreviews {
+		t.Errorf("permissions() = %+v, want messages, photos and previews", permissions)
+	}
+	if permissions.CanSendVideos || permissions.CanSendPolls {
+		t.Errorf("permissions() = %+v, want only listed rights", permissions)
+	}
+
+	MainConfig = Config{}
+	MainConfig.RightsTiers = []RightsTier{{Rights: []string{"messages", "stickers"}}}
+	if err := readRightsTiers(); err == nil {
+		t.Errorf("readRightsTiers() accepted unknown right")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -50,9 +51,11 @@ type Section struct {
 	Name string `yaml:"name"`
 }
 
-var oldconfig combotTrigger
+// Trigger sets by file name, chats can share the same set
+var triggerSets map[string]combotTrigger
+var triggersMutex sync.RWMutex
 
-func CheckTriggerMessage(message *tgbotapi.Message) bool {
+func CheckTriggerMessage(chat ChatConfig, message *tgbotapi.Message) bool {
 	now := time.Now()
 	if now.Sub(message.Time()) > time.Minute*5 {
 		slog.Warn("Old message took too long", "message", message.Time().UTC())
@@ -60,7 +63,7 @@ func CheckTriggerMessage(message *tgbotapi.Message) bool {
 	}
 
 	triggered := false
-	for _, trigger := range oldconfig.Trigger {
+	for _, trigger := range getTriggers(chat).Trigger {
 		for _, condition := range trigger.Conditions {
 			if strings.EqualFold(message.Text, condition.Value) {
 				triggered = true
@@ -127,7 +130,6 @@ func CheckTriggerMessage(message *tgbotapi.Message) bool {
 			triggered = false
 			slog.Info(fmt.Sprintf("Source message: %d", message.MessageID))
 			slog.Info(fmt.Sprintf("TriggeredGood: %s", message.Text))
-			cleanTriggers()
 		}
 	}
 	return triggered
@@ -138,31 +140,55 @@ func isQuestion(message string) bool {
 }
 
 func readTriggers() {
-	configFile, err := os.ReadFile("triggers.yaml")
+	sets := make(map[string]combotTrigger)
+	files := []string{MainConfig.Triggers}
+	for _, chat := range MainConfig.Chats {
+		files = append(files, chat.Triggers)
+	}
+
+	for _, filename := range unique(files) {
+		sets[filename] = readTriggersFile(filename)
+	}
+	triggersMutex.Lock()
+	triggerSets = sets
+	triggersMutex.Unlock()
+}
+
+func readTriggersFile(filename string) combotTrigger {
+	var triggers combotTrigger
+	configFile, err := os.ReadFile(filename)
 	if err != nil {
 		log.Panic(err)
 	}
-	err = yaml.Unmarshal(configFile, &oldconfig)
+	err = yaml.Unmarshal(configFile, &triggers)
 	if err != nil {
 		log.Panic(err)
 	}
-	slog.Info(fmt.Sprintf("Triggers loaded: %d", len(oldconfig.Trigger)))
-	slog.Info(fmt.Sprintf("Sections loaded: %d", len(oldconfig.Section)))
+	slog.Info(fmt.Sprintf("Triggers loaded from %s: %d", filename, len(triggers.Trigger)))
+	slog.Info(fmt.Sprintf("Sections loaded from %s: %d", filename, len(triggers.Section)))
 
-	sort.Slice(oldconfig.Trigger, func(i, j int) bool {
-		return oldconfig.Trigger[i].Name < oldconfig.Trigger[j].Name
+	sort.Slice(triggers.Trigger, func(i, j int) bool {
+		return triggers.Trigger[i].Name < triggers.Trigger[j].Name
 	})
+	return triggers
+}
+
+func getTriggers(chat ChatConfig) combotTrigger {
+	triggersMutex.RLock()
+	defer triggersMutex.RUnlock()
+	return triggerSets[chat.Triggers]
 }
 
-func getSectionsList() []Section {
-	return oldconfig.Section
+func getSectionsList(chat ChatConfig) []Section {
+	return getTriggers(chat).Section
 }
 
-func getTriggersList() string {
+func getTriggersList(chatID int64) string {
 	message := ""
-	sections := getSectionsList()
+	chat := getChatConfig(chatID)
+	sections := getSectionsList(chat)
 	sectionTriggers := make(map[string]string)
-	for _, trigger := range oldconfig.Trigger {
+	for _, trigger := range getTriggers(chat).Trigger {
 		if len(trigger.Conditions) > 0 {
 			var words []string
 			for _, condition := range trigger.Conditions {
@@ -185,41 +211,11 @@ func getTriggersList() string {
 }
 
 func delayDeleteTrigger(message tgbotapi.Message, userID int64) {
-	cache.DeleteTriggerList = append(cache.DeleteTriggerList, WelcomeMessage{
-		ID:        message.MessageID,
-		UserID:    userID,
+	schedule(Job{
+		Kind:      JOB_DELETE_MESSAGE,
 		ChatID:    message.Chat.ID,
-		Timestamp: time.Now().UTC().Add(time.Hour * 44),
+		UserID:    userID,
+		MessageID: message.MessageID,
+		Due:       time.Now().UTC().Add(TRIGGER_TTL),
 	})
 }
-
-func cleanTriggers() int {
-	now := time.Now().UTC()
-	counter := 0
-
-	if len(cache.DeleteTriggerList) > 0 {
-		retainedTriggers := make([]WelcomeMessage, 0, len(cache.DeleteTriggerList))
-
-		result := make(map[int64][]int)
-
-		for _, trigger := range cache.DeleteTriggerList {
-			if trigger.Timestamp.Before(now) {
-				result[trigger.ChatID] = append(result[trigger.ChatID], trigger.ID)
-				counter++
-			} else {
-				retainedTriggers = append(retainedTriggers, trigger)
-			}
-		}
-
-		if counter > 0 {
-			cache.DeleteTriggerList = retainedTriggers
-			saveCache()
-		}
-
-		for chatId, messages := range result {
-			deleteMessages(chatId, messages)
-		}
-	}
-
-	return counter
-}
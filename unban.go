@@ -0,0 +1,100 @@
+package main
+
+/*
+ - /unban by user ID, @username or as a reply to a forwarded message.
+ - User is unbanned in managed chats of the admin and removed from their welcome queue.
+ - Local ban list is shared by all chats, entries are removed by bot admins or the admin who added them.
+*/
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/OvyFlash/telegram-bot-api"
+)
+
+// userArgument parses user ID or @username of a command
+func userArgument(arg string) (int64, error) {
+	if strings.HasPrefix(arg, "@") {
+		userID := findUserID(arg)
+		if userID == 0 {
+			return 0, fmt.Errorf("user %s was not seen yet, use ID", arg)
+		}
+		return userID, nil
+	}
+	userID, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("wrong user id: %s", arg)
+	}
+	return userID, nil
+}
+
+// unbanTarget finds the user from arguments or the forwarded message
+func unbanTarget(message tgbotapi.Message) (int64, error) {
+	args := strings.Fields(message.CommandArguments())
+	if len(args) > 0 {
+		return userArgument(args[0])
+	}
+
+	if message.ReplyToMessage != nil && message.ReplyToMessage.ForwardOrigin != nil {
+		origin := message.ReplyToMessage.ForwardOrigin
+		if origin.SenderUser != nil {
+			return origin.SenderUser.ID, nil
+		}
+		if origin.Type == "hidden_user" {
+			return 0, fmt.Errorf("%s hides forwards, use ID or @username", origin.SenderUserName)
+		}
+	}
+	return 0, fmt.Errorf("usage: /unban user_id, /unban @username or reply /unban to a forwarded message")
+}
+
+// unbanUser lifts bans in chats of the admin, so the user can join and get welcome again
+func unbanUser(userID int64, adminID int64) string {
+	var failed []string
+	chats := adminChats(adminID)
+	for _, chatID := range chats {
+		entry := ModerationEntry{Action: "unban", ChatID: chatID, UserID: userID, AdminID: adminID}
+		if err := liftChatBan(chatID, userID); err != nil {
+			entry.Error = err.Error()
+			failed = append(failed, strconv.FormatInt(chatID, 10))
+		}
+		logModeration(entry)
+	}
+
+	inBanList := false
+	if ban := cache.GetBan(userID); ban != nil && (isAdmin(adminID) || ban.BannedBy == adminID) {
+		inBanList = cache.RemoveBan(userID)
+	}
+	for _, welcome := range cache.WelcomeQueue() {
+		if welcome.UserID == userID && slices.Contains(chats, welcomeChatConfig(welcome).ID) {
+			deleteMessage(welcome.ChatID, welcome.ID)
+			cache.RemoveWelcomeByUser(userID, welcome.ChatID)
+		}
+	}
+	for _, member := range cache.Members() {
+		if member.Id == userID && slices.Contains(chats, member.ChatId) {
+			cache.RemoveMember(userID, member.ChatId)
+		}
+	}
+
+	result := fmt.Sprintf("User %d unbanned in %d of %d chats", userID, len(chats)-len(failed), len(chats))
+	if len(failed) > 0 {
+		result += ", failed: " + strings.Join(failed, ", ")
+	}
+	if inBanList {
+		result += ", removed from ban list"
+	} else if cache.GetBan(userID) != nil {
+		result += ", ban list entry is kept for bot admins"
+	}
+	return result
+}
+
+func unbanCommand(message tgbotapi.Message) string {
+	userID, err := unbanTarget(message)
+	if err != nil {
+		return err.Error()
+	}
+	return unbanUser(userID, message.From.ID)
+}
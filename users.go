@@ -0,0 +1,46 @@
+package main
+
+/*
+ - Usernames of everyone the bot sees are kept to resolve @username to user ID.
+*/
+
+import (
+	"strings"
+
+	tgbotapi "github.com/OvyFlash/telegram-bot-api"
+)
+
+// rememberUser updates username index, store is written only on change
+func rememberUser(user *tgbotapi.User) {
+	if user == nil || user.UserName == "" || user.IsBot {
+		return
+	}
+	username := strings.ToLower(user.UserName)
+	if cache.GetUserID(username) != user.ID {
+		cache.SetUsername(username, user.ID)
+	}
+}
+
+// rememberUpdateUsers indexes the sender and the member who joined or left
+func rememberUpdateUsers(update tgbotapi.Update) {
+	rememberUser(update.SentFrom())
+	if update.ChatMember != nil {
+		rememberUser(update.ChatMember.NewChatMember.User)
+	}
+	if update.ChatJoinRequest != nil {
+		rememberUser(&update.ChatJoinRequest.From)
+	}
+	if update.Message != nil {
+		for id := range update.Message.NewChatMembers {
+			rememberUser(&update.Message.NewChatMembers[id])
+		}
+		if update.Message.ForwardOrigin != nil {
+			rememberUser(update.Message.ForwardOrigin.SenderUser)
+		}
+	}
+}
+
+// findUserID resolves @username, 0 if the user was never seen
+func findUserID(username string) int64 {
+	return cache.GetUserID(strings.ToLower(strings.TrimPrefix(username, "@")))
+}
@@ -0,0 +1,177 @@
+package main
+
+/*
+ - Warnings are strikes of a user in a chat, they expire after `warn_expire`.
+ - Every warning applies the sanction of its number from `warn_escalation`, the last one repeats.
+ - Admins warn by replying /warn reason, /warns shows active warnings.
+ - Rules with warn action (forbidden text, flood, duplicates) add warnings too.
+*/
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/OvyFlash/telegram-bot-api"
+)
+
+const DEFAULT_WARN_EXPIRE = 30 * 24 * time.Hour
+
+type Warning struct {
+	ChatID  int64     `json:"chat_id"`
+	UserID  int64     `json:"user_id"`
+	AdminID int64     `json:"admin_id,omitempty"` //0 is the bot itself
+	Reason  string    `json:"reason,omitempty"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+}
+
+func (warning Warning) isExpired(now time.Time) bool {
+	return !warning.Expires.After(now)
+}
+
+// Sanction is applied for a warning, action is warn, mute for duration or ban
+type Sanction struct {
+	Action   string        `yaml:"action"`
+	Duration time.Duration `yaml:"duration"`
+}
+
+var defaultEscalation = []Sanction{
+	{Action: RULE_ACTION_WARN},
+	{Action: RULE_ACTION_MUTE, Duration: time.Hour},
+	{Action: RULE_ACTION_MUTE, Duration: 24 * time.Hour},
+	{Action: RULE_ACTION_BAN},
+}
+
+func getEscalation(chat ChatConfig) []Sanction {
+	if len(chat.WarnEscalation) == 0 {
+		return defaultEscalation
+	}
+	return chat.WarnEscalation
+}
+
+func getWarnExpire(chat ChatConfig) time.Duration {
+	if chat.WarnExpire <= 0 {
+		return DEFAULT_WARN_EXPIRE
+	}
+	return chat.WarnExpire
+}
+
+// readEscalation checks `warn_escalation` of all chats
+func readEscalation() error {
+	for _, chat := range allChatConfigs() {
+		for _, sanction := range chat.WarnEscalation {
+			switch sanction.Action {
+			case RULE_ACTION_WARN, RULE_ACTION_MUTE, RULE_ACTION_BAN:
+			default:
+				return fmt.Errorf("chat %d: unknown warn_escalation action %q", chat.ID, sanction.Action)
+			}
+		}
+	}
+	return nil
+}
+
+// formatDuration prints whole days, hours or minutes shortly
+func formatDuration(duration time.Duration) string {
+	switch {
+	case duration%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", duration/(24*time.Hour))
+	case duration%time.Hour == 0:
+		return fmt.Sprintf("%dh", duration/time.Hour)
+	case duration%time.Minute == 0:
+		return fmt.Sprintf("%dm", duration/time.Minute)
+	}
+	return duration.String()
+}
+
+// warnUser adds a strike and applies the sanction, returns what happened: "warning 2 of 4, muted for 1h"
+func warnUser(chatID int64, userID int64, adminID int64, reason string) string {
+	chat := getChatConfig(chatID)
+	now := time.Now().UTC()
+	cache.AddWarning(Warning{
+		ChatID:  chatID,
+		UserID:  userID,
+		AdminID: adminID,
+		Reason:  reason,
+		Created: now,
+		Expires: now.Add(getWarnExpire(chat)),
+	})
+	logModeration(ModerationEntry{Action: "warn", ChatID: chatID, UserID: userID, AdminID: adminID, Reason: reason})
+
+	count := len(cache.Warnings(userID, chatID, now))
+	escalation := getEscalation(chat)
+	result := fmt.Sprintf("warning %d", count)
+	if count <= len(escalation) {
+		result += fmt.Sprintf(" of %d", len(escalation))
+	}
+	sanction := escalation[min(count, len(escalation))-1]
+	switch sanction.Action {
+	case RULE_ACTION_MUTE:
+		duration := sanction.Duration
+		if duration == 0 {
+			duration = DEFAULT_MUTE_DURATION
+		}
+		muteUser(chatID, userID, duration, adminID, "warnings: "+reason)
+		result += ", muted for " + formatDuration(duration)
+	case RULE_ACTION_BAN:
+		banUser(chatID, userID, adminID, "warnings: "+reason)
+		result += ", banned"
+	}
+	return result
+}
+
+// warnCommand warns the author of the replied message
+func warnCommand(chat ChatConfig, message tgbotapi.Message) string {
+	target := message.ReplyToMessage
+	if target == nil || target.From == nil || target.SenderChat != nil {
+		return "Reply /warn reason to a message of the user"
+	}
+	if target.From.IsBot || isChatAdmin(chat, target.From.ID) {
+		return "Admins and bots are not warned"
+	}
+	reason := strings.TrimSpace(message.CommandArguments())
+	if reason == "" {
+		reason = "warned by admin"
+	}
+	result := warnUser(message.Chat.ID, target.From.ID, message.From.ID, reason)
+	return getNameLink(*target.From) + ", " + result + ": " + html.EscapeString(reason)
+}
+
+// warnsCommand lists active warnings of the replied or given user, in the chat or in chats of the admin for private
+func warnsCommand(message tgbotapi.Message) string {
+	var userID int64
+	if args := strings.Fields(message.CommandArguments()); len(args) > 0 {
+		var err error
+		if userID, err = userArgument(args[0]); err != nil {
+			return html.EscapeString(err.Error())
+		}
+	} else if message.ReplyToMessage != nil && message.ReplyToMessage.From != nil {
+		userID = message.ReplyToMessage.From.ID
+	} else {
+		return "Usage: /warns user_id, /warns @username or reply /warns to a message"
+	}
+
+	chats := []int64{message.Chat.ID}
+	if message.Chat.IsPrivate() {
+		chats = adminChats(message.From.ID)
+	}
+	now := time.Now().UTC()
+	var lines []string
+	for _, chatID := range chats {
+		for _, warning := range cache.Warnings(userID, chatID, now) {
+			line := warning.Created.Format("2006-01-02 15:04") + " " + html.EscapeString(warning.Reason)
+			if warning.AdminID != 0 {
+				line += fmt.Sprintf(", by %d", warning.AdminID)
+			}
+			if message.Chat.IsPrivate() {
+				line += fmt.Sprintf(", chat %d", chatID)
+			}
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return fmt.Sprintf("User %d has no warnings", userID)
+	}
+	return fmt.Sprintf("User %d has %d warnings:\n", userID, len(lines)) + strings.Join(lines, "\n")
+}
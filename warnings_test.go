@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/OvyFlash/telegram-bot-api"
+)
+
+func Test_formatDuration(t *testing.T) {
+	tests := map[time.Duration]string{
+		time.Hour:        "1h",
+		24 * time.Hour:   "1d",
+		90 * time.Minute: "90m",
+		90 * time.Second: "1m30s",
+	}
+	for duration, want := range tests {
+		if got := formatDuration(duration); got != want {
+			t.Errorf("formatDuration(%v) = %q, want %q", duration, got, want)
+		}
+	}
+}
+
+func warnUpdate(admin tgbotapi.User, target tgbotapi.User, args string) tgbotapi.Update {
+	update := commandUpdate(admin, "/warn "+args)
+	update.Message.Chat = tgbotapi.Chat{ID: testChatID, Type: "supergroup"}
+	update.Message.ReplyToMessage = messageUpdate(target, "bad words").Message
+	return update
+}
+
+func Test_warnEscalation(t *testing.T) {
+	fake := setupTestBot(t)
+
+	wants := []string{"warning 1 of 4: spam", "warning 2 of 4, muted for 1h", "warning 3 of 4, muted for 1d", "warning 4 of 4, banned", "warning 5, banned"}
+	for i, want := range wants {
+		fake.reset()
+		processUpdate(warnUpdate(tgbotapi.User{ID: testAdminID}, testUser, "spam"))
+		sent := fake.methodCalls("sendMessage")
+		if len(sent) != 1 || !strings.Contains(sent[0].Params.Get("text"), want) {
+			t.Fatalf("warning %d: sendMessage calls = %v, want %q", i+1, sent, want)
+		}
+	}
+	if cache.GetBan(testUser.ID) == nil {
+		t.Fatal("user is not banned after the last warning")
+	}
+
+	fake.reset()
+	processUpdate(commandUpdate(tgbotapi.User{ID: testAdminID}, "/warns 500"))
+	sent := fake.methodCalls("sendMessage")
+	if len(sent) != 1 || !strings.Contains(sent[0].Params.Get("text"), "has 5 warnings") {
+		t.Fatalf("sendMessage calls = %v, want warnings list", sent)
+	}
+}
+
+func Test_warnByNonAdmin(t *testing.T) {
+	fake := setupTestBot(t)
+
+	processUpdate(warnUpdate(testUser, tgbotapi.User{ID: 600, FirstName: "Other"}, "spam"))
+
+	if deletes := fake.methodCalls("deleteMessage"); len(deletes) != 1 {
+		t.Fatalf("deleteMessage calls = %v, want command deleted", deletes)
+	}
+	if sent := fake.methodCalls("sendMessage"); len(sent) != 0 {
+		t.Fatalf("sendMessage calls = %v, want no answer", sent)
+	}
+	if warnings := cache.Warnings(600, testChatID, time.Now().UTC()); len(warnings) != 0 {
+		t.Fatalf("warnings = %+v, want none", warnings)
+	}
+}
+
+func Test_ruleWarningsEscalate(t *testing.T) {
+	fake := setupTestBot(t)
+	chat := MainConfig.Chats[testChatID]
+	chat.ForbiddenText = []ForbiddenRule{{Text: "casino", Action: RULE_ACTION_WARN}}
+	chat.WarnEscalation = []Sanction{{Action: RULE_ACTION_WARN}, {Action: RULE_ACTION_MUTE, Duration: 30 * time.Minute}}
+	MainConfig.Chats[testChatID] = chat
+	if err := readForbiddenText(); err != nil {
+		t.Fatal(err)
+	}
+
+	processUpdate(messageUpdate(testUser, "casino"))
+	if restricts := fake.methodCalls("restrictChatMember"); len(restricts) != 0 {
+		t.Fatalf("restrictChatMember calls = %v, want only warning", restricts)
+	}
+	processUpdate(messageUpdate(testUser, "casino"))
+	restricts := fake.methodCalls("restrictChatMember")
+	if len(restricts) != 1 || restricts[0].Params.Get("until_date") == "" {
+		t.Fatalf("restrictChatMember calls = %v, want mute on the second warning", restricts)
+	}
+	sent := fake.methodCalls("sendMessage")
+	if len(sent) != 2 || !strings.Contains(sent[1].Params.Get("text"), "muted for 30m") {
+		t.Fatalf("sendMessage calls = %v, want warnings", sent)
+	}
+}
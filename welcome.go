@@ -4,27 +4,40 @@ package main
  - Show welcome message on join with inline-button.
  - Set lowest rights
  - If button clicked, set guest rights, remove welcome message.
+ - The button or another challenge of the chat, suspicious users always get a question.
+ - Wrong answers and timeout apply `captcha_action` of the chat.
 */
 
 import (
 	"fmt"
 	"log"
 	"log/slog"
-	"strconv"
-	"strings"
 	"time"
 
 	tgbotapi "github.com/OvyFlash/telegram-bot-api"
 )
 
+const DEFAULT_CAPTCHA_MESSAGE = "{namelink}, {question}"
+const DEFAULT_CAPTCHA_TIMEOUT = 2 * time.Hour
+const DEFAULT_CAPTCHA_BAN_DURATION = 6 * time.Hour
+
 type WelcomeMessage struct {
 	ID        int
 	UserID    int64
 	ChatID    int64
 	Timestamp time.Time
+	Answer    string `json:"answer,omitempty"`    //Expected captcha answer
+	Challenge string `json:"challenge,omitempty"` //Empty is the button
+	Attempts  int    `json:"attempts,omitempty"`  //Wrong answers given
+	JoinChat  int64  `json:"join_chat,omitempty"` //Join request to approve, the challenge is in private chat
+}
+
+func welcomeNewUser(chat ChatConfig, update tgbotapi.Update, user tgbotapi.User) {
+	welcomeWithChallenge(chat, update, user, getChallenge(chat.Challenge))
 }
 
-func welcomeNewUser(update tgbotapi.Update, user tgbotapi.User) {
+// welcomeWithChallenge sends the challenge question, typed answers need the right to write
+func welcomeWithChallenge(chat ChatConfig, update tgbotapi.Update, user tgbotapi.User, challenge Challenge) {
 	var chatid int64
 	if update.Message == nil {
 		chatid = update.ChatMember.Chat.ID
@@ -32,31 +45,24 @@ func welcomeNewUser(update tgbotapi.Update, user tgbotapi.User) {
 		chatid = update.Message.Chat.ID
 	}
 
-	// Greet new user
-	welcomeMessage := strings.Replace(MainConfig.WelcomeMessage, "{namelink}", getNameLink(user), -1)
-	msg := tgbotapi.NewMessage(chatid, welcomeMessage)
-
-	//Add Inline callback
-	userid := strconv.Itoa(int(user.ID))
-	callbackData := "{\"command\": \"upgrade_rights\", \"data\": \"" + userid + "\"}"
-
-	var keyboard = tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(MainConfig.WelcomeButtonMessage, callbackData),
-		),
-	)
+	text, keyboard, answer := challenge.Question(chat, user)
+	msg := tgbotapi.NewMessage(chatid, text)
 	msg.LinkPreviewOptions.IsDisabled = true
 	msg.ParseMode = "HTML"
-	msg.ReplyMarkup = keyboard
+	if keyboard != nil {
+		msg.ReplyMarkup = *keyboard
+	}
 
 	if emulate {
-		log.Println("Welcome for " + user.UserName)
-	} else {
-		messageSent, _ := bot.Send(msg)
-		welcomeSent(messageSent, user.ID)
-		slog.Debug(fmt.Sprintf("Welcome sent %d, user %s(%d)", messageSent.MessageID, user.UserName, user.ID))
-		saveCache()
+		log.Println("Welcome " + challenge.Name() + " for " + user.UserName)
+		return
+	}
+	messageSent, _ := bot.Send(msg)
+	scheduleChallenge(chat, welcomeSent(chat, messageSent, user.ID, challenge.Name(), answer), user)
+	if challenge.Typed() {
+		restrictChatMember(chatid, user.ID, tgbotapi.ChatPermissions{CanSendMessages: true}, true)
 	}
+	slog.Debug(fmt.Sprintf("Welcome %s sent %d, user %s(%d)", challenge.Name(), messageSent.MessageID, user.UserName, user.ID))
 }
 
 func setInitialRights(update tgbotapi.Update, user tgbotapi.User) {
@@ -73,6 +79,7 @@ func setInitialRights(update tgbotapi.Update, user tgbotapi.User) {
 		chatid = update.Message.Chat.ID
 	}
 
+	memberJoined(chatid, user.ID)
 	initialRights := tgbotapi.ChatPermissions{
 		CanSendMessages: false,
 	}
@@ -92,18 +99,47 @@ func setInitialRights(update tgbotapi.Update, user tgbotapi.User) {
 	}
 }
 
+// upgradeUserRights gives rights of the reached tier after welcome
 func upgradeUserRights(chatID int64, userid int64) {
-	// Logic to upgrade user rights
-	// Giving the user the ability to send messages
-	defaultRights := tgbotapi.ChatPermissions{
-		CanSendMessages:       true,
-		CanSendPolls:          true,
-		CanSendOtherMessages:  true,
-		CanInviteUsers:        true,
-		CanAddWebPagePreviews: true,
+	stats := cache.GetStats(userid, chatID)
+	if stats == nil || stats.Joined.IsZero() {
+		// Join was not seen, tiers start now
+		memberJoined(chatID, userid)
+		stats = cache.GetStats(userid, chatID)
 	}
-	defaultRights.SetCanSendMediaMessages(true)
+	tiers := getRightsTiers(getChatConfig(chatID))
+	tier := reachedTier(tiers, *stats, time.Now().UTC())
+	rights := tgbotapi.ChatPermissions{CanSendMessages: true}
+	if tier > 0 {
+		rights = tiers[tier-1].permissions()
+	}
+	setUserRights(chatID, userid, rights, true)
+	stats.Tier = tier
+	stats.MediaFrozen = false
+	cache.SetStats(*stats)
+}
 
+// Rights of users with restricted media, set as independent permissions, otherwise previews imply media
+var textOnlyRights = tgbotapi.ChatPermissions{
+	CanSendMessages:       true,
+	CanInviteUsers:        true,
+	CanAddWebPagePreviews: true,
+}
+
+// restrictUserMedia gives text-only rights, rights tiers and lifted mutes don't upgrade them later
+func restrictUserMedia(chatID int64, userid int64) {
+	setUserRights(chatID, userid, textOnlyRights, true)
+	freezeMediaRights(chatID, userid)
+}
+
+func setUserRights(chatID int64, userid int64, rights tgbotapi.ChatPermissions, independent bool) {
+	restrictChatMember(chatID, userid, rights, independent)
+	cache.RemoveMember(userid, chatID)
+	cache.RemoveWelcomeByUser(userid, chatID)
+}
+
+// restrictChatMember only sets rights, welcome state is kept
+func restrictChatMember(chatID int64, userid int64, rights tgbotapi.ChatPermissions, independent bool) {
 	config := tgbotapi.RestrictChatMemberConfig{
 		ChatMemberConfig: tgbotapi.ChatMemberConfig{
 			ChatConfig: tgbotapi.ChatConfig{
@@ -111,12 +147,10 @@ func upgradeUserRights(chatID int64, userid int64) {
 			},
 			UserID: userid,
 		},
-		UseIndependentChatPermissions: false,
-		Permissions:                   &defaultRights,
+		UseIndependentChatPermissions: independent,
+		Permissions:                   &rights,
 	}
 	bot.Send(config)
-	clearCachedUser(userid)
-	clearDeleteListByUser(userid)
 }
 
 func answerCallbackQuery(callbackQueryID string, text string) {
@@ -124,38 +158,33 @@ func answerCallbackQuery(callbackQueryID string, text string) {
 	bot.Send(callbackConfig)
 }
 
-func welcomeSent(message tgbotapi.Message, userID int64) {
-	// Add message with timestamp + 2 hours
-	cache.DeleteList = append(cache.DeleteList, WelcomeMessage{
+// welcomeSent queues the question, chat is the profile the user joins, not always the chat of the message
+func welcomeSent(chat ChatConfig, message tgbotapi.Message, userID int64, challenge string, answer string) WelcomeMessage {
+	// Add message with timestamp + captcha timeout
+	welcome := WelcomeMessage{
 		ID:        message.MessageID,
 		UserID:    userID,
 		ChatID:    message.Chat.ID,
-		Timestamp: time.Now().UTC().Add(time.Hour * 2),
-	})
+		Timestamp: time.Now().UTC().Add(getCaptchaTimeout(chat)),
+		Answer:    answer,
+		Challenge: challenge,
+	}
+	cache.AddWelcome(welcome)
+	return welcome
 }
 
 func CleanUpWelcome() int {
 	// Remove entries older than now
-	now := time.Now().UTC()
 	counter := 0
-	if len(cache.DeleteList) > 0 {
-		for id := 0; id < len(cache.DeleteList); id++ {
-			if cache.DeleteList[id].Timestamp.Before(now) {
-				slog.Info(fmt.Sprintf("Deleting message id %d", cache.DeleteList[id].ID))
-				deleteMessage(cache.DeleteList[id].ChatID, cache.DeleteList[id].ID)
-				kickChatMember(cache.DeleteList[id].ChatID, cache.DeleteList[id].UserID)
-				clearCachedUser(cache.DeleteList[id].UserID)
-				//clearDeleteListByUser(message.UserID)
-				cache.DeleteList = append(cache.DeleteList[:id], cache.DeleteList[id+1:]...)
-				id--
-				counter++
-			}
-		}
-		saveCache()
+	for _, welcome := range cache.PopExpiredWelcomes(time.Now().UTC()) {
+		slog.Info(fmt.Sprintf("Deleting message id %d", welcome.ID))
+		deleteMessage(welcome.ChatID, welcome.ID)
+		failChallenge(welcome, "captcha timeout")
+		counter++
 	}
 	return counter
 }
 
 func CleanWelcomeQueue() {
-	cache.Member = nil
+	cache.ClearMembers()
 }